@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/imagesource"
+	"github.com/docker/go-units"
+)
+
+// diff prints the differences between the old and the new archive
+func diff(oldFn, newFn string) error {
+	old, err := imagesource.NewZipImageSource(oldFn)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	newSource, err := imagesource.NewZipImageSource(newFn)
+	if err != nil {
+		return err
+	}
+	defer newSource.Close()
+
+	d := old.Diff(newSource)
+	return printOutput(d, nil, func() error { return printDiff(d) })
+}
+
+func printDiff(d diz.Diff) error {
+	printTags("Added tags", d.AddedTags)
+	printTags("Removed tags", d.RemovedTags)
+	if len(d.ChangedTags) > 0 {
+		fmt.Println("Changed tags:")
+		for _, c := range d.ChangedTags {
+			fmt.Printf("  %s: %s -> %s\n", c.Tag, shortID(c.OldConfig), shortID(c.NewConfig))
+		}
+	}
+	if len(d.RetaggedImages) > 0 {
+		fmt.Println("Retagged images:")
+		for _, r := range d.RetaggedImages {
+			fmt.Printf("  %s: %s -> %s\n", shortID(r.Config), strings.Join(r.OldTags, ", "), strings.Join(r.NewTags, ", "))
+		}
+	}
+	printLayers("Added layers", d.AddedLayers)
+	printLayers("Removed layers", d.RemovedLayers)
+	fmt.Printf("Transfer size: %s\n", units.HumanSize(float64(d.TransferSize)))
+
+	return nil
+}
+
+func printTags(title string, tags []string) {
+	if len(tags) > 0 {
+		fmt.Printf("%s: %s\n", title, strings.Join(tags, ", "))
+	}
+}
+
+func printLayers(title string, layers []diz.Layer) {
+	if len(layers) > 0 {
+		var size, compressed int64
+		for _, l := range layers {
+			size += l.Size
+			compressed += l.CompressedSize
+		}
+		fmt.Printf("%s (%s, %s compressed):\n", title, units.HumanSize(float64(size)), units.HumanSize(float64(compressed)))
+		for _, l := range layers {
+			fmt.Printf("  %s %s (%s compressed)\n", shortID(l.Hash), units.HumanSize(float64(l.Size)), units.HumanSize(float64(l.CompressedSize)))
+		}
+	}
+}
+
+// shortID returns the first 12 characters of the ID of the config or hash, like the Docker CLI
+func shortID(id string) string {
+	id = strings.TrimSuffix(id, ".json")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
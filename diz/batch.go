@@ -0,0 +1,105 @@
+package diz
+
+// BatchManifests splits the manifests into batches whose total size stays within the budget. Manifests sharing layers
+// are kept in the same batch when they fit. Otherwise they are split, and the shared layers are counted again in every
+// batch loading them. A manifest exceeding the budget on its own forms a single batch. The size of an image file is
+// returned by the size function. A budget less than or equal to zero yields a single batch
+func BatchManifests(manifests []Manifest, budget int64, size func(name string) int64) (result [][]Manifest) {
+	if len(manifests) == 0 {
+		return
+	}
+	if budget <= 0 {
+		return [][]Manifest{manifests}
+	}
+
+	// Group manifests sharing layers, using union-find on the manifest indices
+	parent := make([]int, len(manifests))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	owner := make(map[string]int, 0)
+	for i, m := range manifests {
+		for _, l := range m.Layers {
+			if j, ok := owner[l]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				owner[l] = i
+			}
+		}
+	}
+
+	var groups [][]Manifest
+	groupIndex := make(map[int]int, 0)
+	for i, m := range manifests {
+		root := find(i)
+		if g, ok := groupIndex[root]; ok {
+			groups[g] = append(groups[g], m)
+		} else {
+			groupIndex[root] = len(groups)
+			groups = append(groups, []Manifest{m})
+		}
+	}
+
+	// Pack the groups into batches, in order, starting a new batch for a group not fitting the current one. Groups
+	// share no layers, so a batch is sized by its own distinct files
+	var batch []Manifest
+	var batchSize int64
+	files := make(map[string]bool, 0)
+	flush := func() {
+		result = append(result, batch)
+		batch, batchSize, files = nil, 0, make(map[string]bool, 0)
+	}
+	for _, g := range groups {
+		if len(batch) > 0 && batchSize+manifestsSize(g, size) > budget {
+			flush()
+		}
+		for _, m := range g {
+			names := append([]string{m.Config}, m.Layers...)
+			if len(batch) > 0 && batchSize+newSize(names, files, size) > budget {
+				flush()
+			}
+			batch = append(batch, m)
+			batchSize += newSize(names, files, size)
+			for _, name := range names {
+				files[name] = true
+			}
+		}
+	}
+
+	return append(result, batch)
+}
+
+// manifestsSize returns the total size of the distinct configs and layers of the manifests
+func manifestsSize(manifests []Manifest, size func(name string) int64) int64 {
+	files := make(map[string]bool, 0)
+	var result int64
+	for _, m := range manifests {
+		names := append([]string{m.Config}, m.Layers...)
+		result += newSize(names, files, size)
+		for _, name := range names {
+			files[name] = true
+		}
+	}
+	return result
+}
+
+// newSize returns the total size of the distinct image files not in the batch files
+func newSize(names []string, files map[string]bool, size func(name string) int64) (result int64) {
+	seen := make(map[string]bool, 0)
+	for _, name := range names {
+		if !files[name] && !seen[name] {
+			seen[name] = true
+			if s := size(name); s > 0 {
+				result += s
+			}
+		}
+	}
+	return
+}
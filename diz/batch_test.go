@@ -0,0 +1,49 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchManifests(t *testing.T) {
+	sizes := map[string]int64{"a.json": 1, "b.json": 1, "c.json": 1, "d.json": 1, "base/layer.tar": 50, "x/layer.tar": 20, "y/layer.tar": 20, "z/layer.tar": 60, "w/layer.tar": 10}
+	size := func(name string) int64 { return sizes[name] }
+	a := Manifest{Config: "a.json", RepoTags: []string{"a"}, Layers: []string{"base/layer.tar", "x/layer.tar"}}
+	b := Manifest{Config: "b.json", RepoTags: []string{"b"}, Layers: []string{"z/layer.tar"}}
+	c := Manifest{Config: "c.json", RepoTags: []string{"c"}, Layers: []string{"base/layer.tar", "y/layer.tar"}}
+	d := Manifest{Config: "d.json", RepoTags: []string{"d"}, Layers: []string{"w/layer.tar"}}
+	manifests := []Manifest{a, b, c, d}
+
+	assert.Nil(t, BatchManifests(nil, 100, size))
+	assert.Equal(t, [][]Manifest{manifests}, BatchManifests(manifests, 0, size))
+	// a and c share the base layer (92 bytes together) and are kept in one batch
+	assert.Equal(t, [][]Manifest{{a, c}, {b, d}}, BatchManifests(manifests, 100, size))
+	// a and c are split when exceeding the budget, loading the base layer in both batches
+	assert.Equal(t, [][]Manifest{{a}, {c}, {b, d}}, BatchManifests(manifests, 80, size))
+	// Manifests larger than the budget form their own batch
+	assert.Equal(t, [][]Manifest{{a}, {c}, {b}, {d}}, BatchManifests(manifests, 50, size))
+	for _, budget := range []int64{80, 100} {
+		assertWithinBudget(t, BatchManifests(manifests, budget, size), budget, size)
+	}
+}
+
+// assertWithinBudget asserts that the distinct files of every batch fit the budget
+func assertWithinBudget(t *testing.T, batches [][]Manifest, budget int64, size func(name string) int64) {
+	for _, batch := range batches {
+		assert.LessOrEqual(t, manifestsSize(batch, size), budget)
+	}
+}
+
+func TestBatchManifestsCommonBase(t *testing.T) {
+	sizes := map[string]int64{"a.json": 1, "b.json": 1, "c.json": 1, "base/layer.tar": 50, "x/layer.tar": 10, "y/layer.tar": 10, "z/layer.tar": 10}
+	size := func(name string) int64 { return sizes[name] }
+	a := Manifest{Config: "a.json", RepoTags: []string{"a"}, Layers: []string{"base/layer.tar", "x/layer.tar"}}
+	b := Manifest{Config: "b.json", RepoTags: []string{"b"}, Layers: []string{"base/layer.tar", "y/layer.tar"}}
+	c := Manifest{Config: "c.json", RepoTags: []string{"c"}, Layers: []string{"base/layer.tar", "z/layer.tar"}}
+
+	// The base layer is counted once per batch, a and b (72 bytes) fit the budget, c alone needs 61 bytes
+	assert.Equal(t, [][]Manifest{{a, b}, {c}}, BatchManifests([]Manifest{a, b, c}, 80, size))
+	assert.Equal(t, [][]Manifest{{a, b, c}}, BatchManifests([]Manifest{a, b, c}, 83, size))
+	assertWithinBudget(t, BatchManifests([]Manifest{a, b, c}, 80, size), 80, size)
+}
@@ -0,0 +1,45 @@
+package diz
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+// ImageConfig holds the parts of the Docker image config used by diz
+type ImageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Variant      string    `json:"variant,omitempty"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ReadFile reads the contents of the image file with the given name
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	f := getDizFile(a.reader, name)
+	if f == nil {
+		return nil, errors.New(name + " not found")
+	}
+	rdr, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	return ioutil.ReadAll(rdr)
+}
+
+// GetImageConfig reads the image config of the manifest
+func (a *Archive) GetImageConfig(m Manifest) (config ImageConfig, err error) {
+	var b []byte
+	if b, err = a.ReadFile(m.Config); err == nil {
+		err = json.Unmarshal(b, &config)
+	}
+
+	return
+}
@@ -0,0 +1,163 @@
+package diz
+
+import (
+	"sort"
+
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/str"
+)
+
+// Layer describes a layer by its content hash
+type Layer struct {
+	Hash           string `json:"hash"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+}
+
+// TagChange describes a tag referring to different configs in two manifest sets
+type TagChange struct {
+	Tag       string `json:"tag"`
+	OldConfig string `json:"oldConfig,omitempty"`
+	NewConfig string `json:"newConfig,omitempty"`
+}
+
+// Retag describes an image present in two manifest sets with different tags
+type Retag struct {
+	Config  string   `json:"config"`
+	OldTags []string `json:"oldTags"`
+	NewTags []string `json:"newTags"`
+}
+
+// Diff describes the differences between two manifest sets
+type Diff struct {
+	AddedTags      []string    `json:"addedTags"`
+	RemovedTags    []string    `json:"removedTags"`
+	RetaggedImages []Retag     `json:"retaggedImages"`
+	ChangedTags    []TagChange `json:"changedTags"`
+	AddedLayers    []Layer     `json:"addedLayers"`
+	RemovedLayers  []Layer     `json:"removedLayers"`
+	// TransferSize is the number of compressed bytes of the added layers
+	TransferSize int64 `json:"transferSize"`
+}
+
+// LayerFunc returns the layer description of the layer with the given name
+type LayerFunc func(name string) Layer
+
+// GetLayer returns the description of the layer with the given name. The name is used as hash if the archive has no hash for the layer
+func (a *Archive) GetLayer(name string) Layer {
+	if f := getDizFile(a.reader, name); f != nil {
+		hash := f.Hash
+		if hash == "" {
+			hash = name
+		}
+		return Layer{Hash: hash, Size: int64(f.UncompressedSize64), CompressedSize: int64(f.FileHeader.CompressedSize64)}
+	}
+
+	return Layer{Hash: name}
+}
+
+// GetLayerByHash returns the description of the layer with the given content hash, and whether the archive has the layer
+func (a *Archive) GetLayerByHash(hash string) (Layer, bool) {
+	if f := a.reader.GetFileByHash(hash); f != nil {
+		return Layer{Hash: hash, Size: int64(f.UncompressedSize64), CompressedSize: int64(f.FileHeader.CompressedSize64)}, true
+	}
+
+	return Layer{Hash: hash}, false
+}
+
+// DiffArchives returns the differences between the old and the new archive
+func DiffArchives(old, newArchive *Archive) Diff {
+	return DiffManifests(old.Manifests, newArchive.Manifests, old.GetLayer, newArchive.GetLayer)
+}
+
+// DiffManifests returns the differences between the old and the new manifests. Tags are compared by normalized reference and layers by content hash
+func DiffManifests(old, newManifests []Manifest, oldLayer, newLayer LayerFunc) (result Diff) {
+	oldTags, oldConfigs := tagsToConfig(old)
+	newTags, _ := tagsToConfig(newManifests)
+
+	for _, m := range newManifests {
+		for _, t := range m.RepoTags {
+			if c, ok := oldTags[dockerref.NormalizeReference(t)]; !ok {
+				result.AddedTags = append(result.AddedTags, t)
+			} else if c != m.Config {
+				result.ChangedTags = append(result.ChangedTags, TagChange{Tag: t, OldConfig: c, NewConfig: m.Config})
+			}
+		}
+		if o, ok := oldConfigs[m.Config]; ok && !sameTags(o.RepoTags, m.RepoTags) {
+			result.RetaggedImages = append(result.RetaggedImages, Retag{Config: m.Config, OldTags: o.RepoTags, NewTags: m.RepoTags})
+		}
+	}
+	for _, m := range old {
+		for _, t := range m.RepoTags {
+			if _, ok := newTags[dockerref.NormalizeReference(t)]; !ok {
+				result.RemovedTags = append(result.RemovedTags, t)
+			}
+		}
+	}
+
+	oldLayers := getLayers(old, oldLayer)
+	newLayers := getLayers(newManifests, newLayer)
+	for _, l := range newLayers {
+		if !containsLayer(oldLayers, l.Hash) {
+			result.AddedLayers = append(result.AddedLayers, l)
+			result.TransferSize += l.CompressedSize
+		}
+	}
+	for _, l := range oldLayers {
+		if !containsLayer(newLayers, l.Hash) {
+			result.RemovedLayers = append(result.RemovedLayers, l)
+		}
+	}
+
+	return
+}
+
+func tagsToConfig(manifests []Manifest) (tags map[string]string, configs map[string]Manifest) {
+	tags = make(map[string]string, 0)
+	configs = make(map[string]Manifest, 0)
+	for _, m := range manifests {
+		for _, t := range m.RepoTags {
+			tags[dockerref.NormalizeReference(t)] = m.Config
+		}
+		configs[m.Config] = m
+	}
+
+	return
+}
+
+func sameTags(a, b []string) bool {
+	na := normalizeTags(a)
+	nb := normalizeTags(b)
+	return len(na) == len(nb) && len(str.RemoveSlice(na, nb)) == 0
+}
+
+func normalizeTags(tags []string) (result []string) {
+	for _, t := range tags {
+		result = append(result, dockerref.NormalizeReference(t))
+	}
+	sort.Strings(result)
+
+	return
+}
+
+func getLayers(manifests []Manifest, layer LayerFunc) (result []Layer) {
+	for _, m := range manifests {
+		for _, name := range m.Layers {
+			if l := layer(name); !containsLayer(result, l.Hash) {
+				result = append(result, l)
+			}
+		}
+	}
+
+	return
+}
+
+func containsLayer(layers []Layer, hash string) bool {
+	for _, l := range layers {
+		if l.Hash == hash {
+			return true
+		}
+	}
+
+	return false
+}
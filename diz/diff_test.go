@@ -0,0 +1,34 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffManifests(t *testing.T) {
+	layers := map[string]Layer{
+		"x/layer.tar": {Hash: "hx", Size: 100, CompressedSize: 10},
+		"y/layer.tar": {Hash: "hy", Size: 200, CompressedSize: 20},
+		"z/layer.tar": {Hash: "hz", Size: 300, CompressedSize: 30},
+	}
+	layer := func(name string) Layer { return layers[name] }
+
+	old := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0", "app:latest"}, Layers: []string{"x/layer.tar", "y/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"tool:1"}, Layers: []string{"x/layer.tar"}},
+	}
+	newManifests := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar", "y/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"docker.io/library/app:latest", "app:1.1"}, Layers: []string{"x/layer.tar", "z/layer.tar"}},
+	}
+
+	d := DiffManifests(old, newManifests, layer, layer)
+	assert.Equal(t, []string{"app:1.1"}, d.AddedTags)
+	assert.Equal(t, []string{"tool:1"}, d.RemovedTags)
+	assert.Equal(t, []TagChange{{Tag: "docker.io/library/app:latest", OldConfig: "a.json", NewConfig: "c.json"}}, d.ChangedTags)
+	assert.Equal(t, []Retag{{Config: "a.json", OldTags: []string{"app:1.0", "app:latest"}, NewTags: []string{"app:1.0"}}}, d.RetaggedImages)
+	assert.Equal(t, []Layer{layers["z/layer.tar"]}, d.AddedLayers)
+	assert.Nil(t, d.RemovedLayers)
+	assert.Equal(t, int64(30), d.TransferSize)
+}
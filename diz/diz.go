@@ -41,7 +41,9 @@ type Manifest struct {
 // Archive holds the data for reading a diz zip archive
 type Archive struct {
 	Manifests []Manifest
-	reader    *hashzip.Reader
+	// Meta is nil for archives written before the metadata was introduced
+	Meta   *Meta
+	reader *hashzip.Reader
 }
 
 type repositories map[string]map[string]string
@@ -53,12 +55,17 @@ func NewArchive(reader io.ReaderAt, size int64) (*Archive, error) {
 		return nil, err
 	}
 
+	meta, err := readMeta(zipReader)
+	if err != nil {
+		return nil, err
+	}
+
 	manifests, err := readManifest(zipReader)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Archive{Manifests: manifests, reader: zipReader}, nil
+	return &Archive{Manifests: manifests, Meta: meta, reader: zipReader}, nil
 }
 
 // GetUncompressedSize returns the uncompressed size of the file with the given name
@@ -105,7 +112,8 @@ func readManifest(zipReader *hashzip.Reader) (manifests []Manifest, err error) {
 
 type fileHandler func(zf *hashzip.File, fn string, contents []byte) error
 
-func (a *Archive) copyTo(handler fileHandler, manifests []Manifest, includeForeign, includeManifests bool) (err error) {
+// References returns the set of config files and layer directories referenced by the manifests
+func References(manifests []Manifest) map[string]bool {
 	include := make(map[string]bool, 0)
 
 	for _, m := range manifests {
@@ -115,6 +123,31 @@ func (a *Archive) copyTo(handler fileHandler, manifests []Manifest, includeForei
 		}
 	}
 
+	return include
+}
+
+// IsReferenced returns true if the image file name (relative to the image root) is part of the references
+func IsReferenced(references map[string]bool, name string) bool {
+	if isArchiveFile(name) {
+		return false
+	}
+	dir := strings.SplitN(name, "/", 2)[0]
+	return references[dir]
+}
+
+// EntryName returns the zip entry name of the image file name
+func EntryName(name string) string {
+	return dizPrefix + name
+}
+
+// ManifestFiles returns the names of the archive entries holding the manifests, metadata and history
+func ManifestFiles() []string {
+	return []string{EntryName(manifestJSON), EntryName(repos), EntryName(metaJSON), EntryName(historyJSON)}
+}
+
+func (a *Archive) copyTo(handler fileHandler, manifests []Manifest, includeForeign, includeManifests bool) (err error) {
+	include := References(manifests)
+
 	var additional map[string][]byte
 	if includeManifests {
 		if additional, err = createManifestRepositories(manifests); err != nil {
@@ -125,13 +158,7 @@ func (a *Archive) copyTo(handler fileHandler, manifests []Manifest, includeForei
 	for _, f := range a.reader.File {
 		included := false
 		if strings.HasPrefix(f.Name, dizPrefix) {
-			fn := f.Name[len(dizPrefix):]
-			if fn != repos && fn != manifestJSON {
-				dir := strings.SplitN(fn, "/", 2)[0]
-				if _, ok := include[dir]; ok {
-					included = true
-				}
-			}
+			included = IsReferenced(include, f.Name[len(dizPrefix):])
 		} else {
 			included = includeForeign
 		}
@@ -147,7 +174,11 @@ func (a *Archive) copyTo(handler fileHandler, manifests []Manifest, includeForei
 		}
 	}
 
-	for k, v := range additional {
+	for _, k := range []string{manifestJSON, repos} {
+		v, ok := additional[k]
+		if !ok {
+			continue
+		}
 		if includeForeign {
 			k = dizPrefix + k
 		}
@@ -226,15 +257,19 @@ func (a *Archive) CopyToTar(writer io.Writer, manifests []Manifest) (err error)
 	return
 }
 
-// CopyFromTar copies the contents of the tar archive to the zip writer. The manifest is not copied
-func CopyFromTar(rdr io.Reader, zipWriter *hashzip.Writer) (manifests []Manifest, err error) {
+// TarHandler handles a single image file read from a Docker image tar archive. Directory names end with '/'
+type TarHandler func(name string, size int64, rdr io.Reader) error
+
+// ReadTar reads the Docker image tar archive, calling the handler for each image file. The manifest is parsed and returned and the repositories file is skipped
+func ReadTar(rdr io.Reader, handler TarHandler) (manifests []Manifest, err error) {
 	tarReader := tar.NewReader(rdr)
 
 	for {
 		var header *tar.Header
-		header, err = tarReader.Next()
-		if err == io.EOF {
-			err = nil
+		if header, err = tarReader.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
 			break
 		}
 		if header.Name == manifestJSON {
@@ -246,17 +281,12 @@ func CopyFromTar(rdr io.Reader, zipWriter *hashzip.Writer) (manifests []Manifest
 				return
 			}
 		} else if header.Name != repos {
-			var entry io.Writer
-			fn := dizPrefix + header.Name
-			if !zipWriter.Exists(fn) {
-				if entry, err = zipWriter.Create(fn); err != nil {
-					return
-				}
-				if header.Typeflag == tar.TypeReg {
-					if _, err = io.Copy(entry, tarReader); err != nil {
-						return
-					}
-				}
+			var size int64
+			if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+				size = header.Size
+			}
+			if err = handler(header.Name, size, tarReader); err != nil {
+				return
 			}
 		}
 	}
@@ -264,12 +294,67 @@ func CopyFromTar(rdr io.Reader, zipWriter *hashzip.Writer) (manifests []Manifest
 	return
 }
 
+// CopyFromTar copies the contents of the tar archive to the zip writer. The manifest is not copied
+func CopyFromTar(rdr io.Reader, zipWriter *hashzip.Writer) (manifests []Manifest, err error) {
+	return ReadTar(rdr, func(name string, size int64, rdr io.Reader) error {
+		return WriteEntry(zipWriter, name, rdr)
+	})
+}
+
+// CopyFromTar copies the contents of the tar archive to the zip writer. Image files present in the archive are copied from it without recompressing. The manifest is not copied
+func (a *Archive) CopyFromTar(rdr io.Reader, zipWriter *hashzip.Writer) (manifests []Manifest, err error) {
+	return ReadTar(rdr, func(name string, size int64, rdr io.Reader) error {
+		fn := dizPrefix + name
+		if zipWriter.Exists(fn) {
+			return nil
+		}
+		if f := a.reader.GetFile(fn); f != nil && int64(f.UncompressedSize64) == size {
+			return zipWriter.Copy(fn, f)
+		}
+		return WriteEntry(zipWriter, name, rdr)
+	})
+}
+
+// WriteEntry writes the image file to the zip writer, unless it already exists
+func WriteEntry(zipWriter *hashzip.Writer, name string, rdr io.Reader) (err error) {
+	var entry io.Writer
+	fn := dizPrefix + name
+	if !zipWriter.Exists(fn) {
+		if entry, err = zipWriter.Create(fn); err != nil {
+			return
+		}
+		_, err = io.Copy(entry, rdr)
+	}
+
+	return
+}
+
+// WriteTarManifests writes the manifest and repositories files to the tar writer
+func WriteTarManifests(tarWriter *tar.Writer, manifests []Manifest) error {
+	if m, err := createManifestRepositories(manifests); err != nil {
+		return err
+	} else {
+		for _, k := range []string{manifestJSON, repos} {
+			v := m[k]
+			if err := tarWriter.WriteHeader(&tar.Header{Name: k, Size: int64(len(v)), Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+				return err
+			}
+			if _, err := tarWriter.Write(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // WriteManifests writes the manifests to the zip writer.
 func WriteManifests(manifests []Manifest, zipWriter *hashzip.Writer) error {
 	if m, err := createManifestRepositories(manifests); err != nil {
 		return err
 	} else {
-		for k, v := range m {
+		for _, k := range []string{manifestJSON, repos} {
+			v := m[k]
 			if entry, err := zipWriter.Create(dizPrefix + k); err != nil {
 				return err
 			} else {
@@ -363,10 +448,12 @@ func GetConfigs(manifests []Manifest) (result []string) {
 	return
 }
 
-// FilterImageTags filters the given image tags according to the glob expressions. A '-' prepending the glob expression means a negative match
+// FilterImageTags filters the given image tags according to the glob expressions. A '-' prepending the glob expression means a negative match.
+// The hidden tags of previous images are only matched by glob expressions containing "@prev"
 func FilterImageTags(repoTags, repoDigests, globTags []string) (result []string) {
+	matchPrevious := MatchesPrevious(globTags)
 	for _, repoTag := range repoTags {
-		if repoTag != "<none>:<none>" {
+		if repoTag != "<none>:<none>" && (matchPrevious || !IsPreviousTag(repoTag)) {
 			first := true
 			match := false
 			for _, globTag := range globTags {
@@ -0,0 +1,63 @@
+package diz
+
+import (
+	"strings"
+
+	"github.com/JohanLindvall/diz/dockerref"
+)
+
+// RemoveTags returns a copy of the manifests with the tags matching the tags glob, and the hidden tags of their
+// previous images, removed. Manifests left without tags are dropped
+func RemoveTags(manifests []Manifest, tags []string) (result []Manifest) {
+	var removed []string
+	for _, m := range manifests {
+		removed = append(removed, FilterImageTags(m.RepoTags, []string{}, tags)...)
+	}
+	for _, m := range manifests {
+		mm := Manifest{Config: m.Config, Layers: m.Layers}
+		for _, t := range m.RepoTags {
+			if !containsReference(removed, t) && !(IsPreviousTag(t) && containsReference(removed, strings.Split(t, previousSeparator)[0])) {
+				mm.RepoTags = append(mm.RepoTags, t)
+			}
+		}
+		if len(mm.RepoTags) > 0 {
+			result = append(result, mm)
+		}
+	}
+
+	return
+}
+
+// containsReference returns true if the tags contain the tag, compared by normalized reference
+func containsReference(tags []string, tag string) bool {
+	for _, t := range tags {
+		if dockerref.CompareReferences(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetRepoTags returns the repo tags of the manifests
+func GetRepoTags(manifests []Manifest) (result []string) {
+	for _, m := range manifests {
+		result = append(result, m.RepoTags...)
+	}
+
+	return
+}
+
+// UnreferencedSize returns the number of compressed bytes of the image files in the archive not referenced by the manifests
+func (a *Archive) UnreferencedSize(manifests []Manifest) (result int64) {
+	references := References(manifests)
+	for _, f := range a.reader.File {
+		if strings.HasPrefix(f.Name, dizPrefix) {
+			if name := f.Name[len(dizPrefix):]; !isArchiveFile(name) && !IsReferenced(references, name) {
+				result += int64(f.FileHeader.CompressedSize64)
+			}
+		}
+	}
+
+	return
+}
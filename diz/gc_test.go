@@ -0,0 +1,19 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveTags(t *testing.T) {
+	a := Manifest{Config: "a.json", RepoTags: []string{"foo/app:1.0", "foo/app:latest"}, Layers: []string{"x/layer.tar"}}
+	b := Manifest{Config: "b.json", RepoTags: []string{"foo/app:0.9"}, Layers: []string{"y/layer.tar"}}
+	c := Manifest{Config: "c.json", RepoTags: []string{"bar:2"}, Layers: []string{"z/layer.tar"}}
+	manifests := []Manifest{a, b, c}
+
+	assert.Equal(t, []Manifest{{Config: "a.json", RepoTags: []string{"foo/app:latest"}, Layers: a.Layers}, c}, RemoveTags(manifests, []string{"foo/app:*", "-foo/app:latest"}))
+	assert.Equal(t, manifests, RemoveTags(manifests, []string{"missing"}))
+	assert.Nil(t, RemoveTags(manifests, []string{"*"}))
+	assert.Equal(t, []string{"foo/app:1.0", "foo/app:latest", "foo/app:0.9", "bar:2"}, GetRepoTags(manifests))
+}
@@ -0,0 +1,139 @@
+package diz
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/hashzip"
+)
+
+const (
+	historyJSON = "history.json"
+	// OperationCreate, OperationUpdate, OperationRemove and OperationRollback are the operations recorded in the history
+	OperationCreate   = "create"
+	OperationUpdate   = "update"
+	OperationRemove   = "rm"
+	OperationRollback = "rollback"
+)
+
+// HistoryEntry describes the tag changes of an operation writing the archive
+type HistoryEntry struct {
+	Time      time.Time   `json:"time"`
+	Operation string      `json:"operation"`
+	User      string      `json:"user,omitempty"`
+	Host      string      `json:"host,omitempty"`
+	Added     []TagChange `json:"added,omitempty"`
+	Removed   []TagChange `json:"removed,omitempty"`
+	Changed   []TagChange `json:"changed,omitempty"`
+}
+
+// NewHistoryEntry returns the history entry of the operation changing the old manifests to the new manifests. The
+// hidden tags of previous images are not recorded
+func NewHistoryEntry(operation string, old, newManifests []Manifest) (result HistoryEntry) {
+	result.Operation = operation
+	oldTags, _ := tagsToConfig(old)
+	newTags, _ := tagsToConfig(newManifests)
+	// names holds the tags as written in the manifests
+	names := make(map[string]string, 0)
+	for _, m := range append(append([]Manifest(nil), old...), newManifests...) {
+		for _, t := range m.RepoTags {
+			names[dockerref.NormalizeReference(t)] = t
+		}
+	}
+	for tag, c := range newTags {
+		if IsPreviousTag(tag) {
+			continue
+		}
+		if o, ok := oldTags[tag]; !ok {
+			result.Added = append(result.Added, TagChange{Tag: names[tag], NewConfig: c})
+		} else if o != c {
+			result.Changed = append(result.Changed, TagChange{Tag: names[tag], OldConfig: o, NewConfig: c})
+		}
+	}
+	for tag, o := range oldTags {
+		if _, ok := newTags[tag]; !ok && !IsPreviousTag(tag) {
+			result.Removed = append(result.Removed, TagChange{Tag: names[tag], OldConfig: o})
+		}
+	}
+	sortTagChanges(result.Added)
+	sortTagChanges(result.Removed)
+	sortTagChanges(result.Changed)
+
+	return
+}
+
+// FilterHistory returns the history entries changing the tag, with only the changes of the tag
+func FilterHistory(history []HistoryEntry, tag string) (result []HistoryEntry) {
+	tag = dockerref.NormalizeReference(tag)
+	filter := func(changes []TagChange) (result []TagChange) {
+		for _, c := range changes {
+			if dockerref.NormalizeReference(c.Tag) == tag {
+				result = append(result, c)
+			}
+		}
+		return
+	}
+	for _, h := range history {
+		h.Added = filter(h.Added)
+		h.Removed = filter(h.Removed)
+		h.Changed = filter(h.Changed)
+		if len(h.Added)+len(h.Removed)+len(h.Changed) > 0 {
+			result = append(result, h)
+		}
+	}
+
+	return
+}
+
+// MergeHistories returns the entries of the histories ordered by time. Entries present in several histories, e.g. of
+// archives updated from a common archive, are kept once
+func MergeHistories(histories ...[]HistoryEntry) (result []HistoryEntry) {
+	seen := make(map[string]bool, 0)
+	for _, history := range histories {
+		for _, h := range history {
+			if b, err := json.Marshal(h); err == nil && !seen[string(b)] {
+				seen[string(b)] = true
+				result = append(result, h)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+
+	return
+}
+
+// GetHistory returns the history of the archive, nil for archives written before it was introduced
+func (a *Archive) GetHistory() (history []HistoryEntry, err error) {
+	if getDizFile(a.reader, historyJSON) == nil {
+		return
+	}
+	var b []byte
+	if b, err = a.ReadFile(historyJSON); err == nil {
+		err = json.Unmarshal(b, &history)
+	}
+
+	return
+}
+
+// WriteHistory writes the history to the zip writer
+func WriteHistory(history []HistoryEntry, zipWriter *hashzip.Writer) error {
+	if b, err := json.Marshal(history); err != nil {
+		return err
+	} else if entry, err := zipWriter.Create(dizPrefix + historyJSON); err != nil {
+		return err
+	} else {
+		_, err = entry.Write(b)
+		return err
+	}
+}
+
+func sortTagChanges(changes []TagChange) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Tag < changes[j].Tag })
+}
+
+// isArchiveFile returns true if the image file name (relative to the image root) holds manifests or archive metadata
+func isArchiveFile(name string) bool {
+	return name == manifestJSON || name == repos || name == metaJSON || name == historyJSON
+}
@@ -0,0 +1,44 @@
+package diz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHistoryEntry(t *testing.T) {
+	old := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0", "app:latest"}},
+		{Config: "b.json", RepoTags: []string{"other:1"}},
+	}
+	newManifests := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0"}},
+		{Config: "c.json", RepoTags: []string{"app:1.1", "app:latest"}},
+	}
+
+	entry := NewHistoryEntry(OperationUpdate, old, newManifests)
+	assert.Equal(t, HistoryEntry{
+		Operation: OperationUpdate,
+		Added:     []TagChange{{Tag: "app:1.1", NewConfig: "c.json"}},
+		Removed:   []TagChange{{Tag: "other:1", OldConfig: "b.json"}},
+		Changed:   []TagChange{{Tag: "app:latest", OldConfig: "a.json", NewConfig: "c.json"}},
+	}, entry)
+
+	history := []HistoryEntry{NewHistoryEntry(OperationCreate, nil, old), entry}
+	assert.Equal(t, []HistoryEntry{
+		{Operation: OperationCreate, Added: []TagChange{{Tag: "other:1", NewConfig: "b.json"}}},
+		{Operation: OperationUpdate, Removed: []TagChange{{Tag: "other:1", OldConfig: "b.json"}}},
+	}, FilterHistory(history, "docker.io/library/other:1"))
+	assert.Nil(t, FilterHistory(history, "missing:1"))
+}
+
+func TestMergeHistories(t *testing.T) {
+	create := HistoryEntry{Time: time.Unix(1, 0), Operation: OperationCreate, Added: []TagChange{{Tag: "app:1", NewConfig: "a.json"}}}
+	update1 := HistoryEntry{Time: time.Unix(3, 0), Operation: OperationUpdate, Added: []TagChange{{Tag: "app:2", NewConfig: "b.json"}}}
+	update2 := HistoryEntry{Time: time.Unix(2, 0), Operation: OperationUpdate, Added: []TagChange{{Tag: "other:1", NewConfig: "c.json"}}}
+
+	// The common create entry is kept once
+	assert.Equal(t, []HistoryEntry{create, update2, update1}, MergeHistories([]HistoryEntry{create, update1}, nil, []HistoryEntry{create, update2}))
+	assert.Nil(t, MergeHistories(nil, nil))
+}
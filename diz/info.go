@@ -0,0 +1,109 @@
+package diz
+
+import (
+	"strings"
+	"time"
+)
+
+// ImageInfo holds size accounting and config details of an image in an archive
+type ImageInfo struct {
+	Config       string    `json:"config"`
+	RepoTags     []string  `json:"repoTags"`
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	Layers       int       `json:"layers"`
+	// Size and CompressedSize are the number of layer bytes of the image
+	Size           int64 `json:"size"`
+	CompressedSize int64 `json:"compressedSize"`
+	// UniqueSize is the number of uncompressed layer bytes not shared with other images, SharedSize the remainder
+	UniqueSize int64 `json:"uniqueSize"`
+	SharedSize int64 `json:"sharedSize"`
+}
+
+// ArchiveInfo holds size accounting of the images in an archive
+type ArchiveInfo struct {
+	Images         []ImageInfo `json:"images"`
+	Size           int64       `json:"size"`
+	CompressedSize int64       `json:"compressedSize"`
+	// Ratio is the uncompressed size divided by the compressed size
+	Ratio float64 `json:"ratio"`
+	Meta  *Meta   `json:"meta,omitempty"`
+}
+
+// GetInfo returns the size accounting and config details of the images in the archive. Layers are not decompressed
+func (a *Archive) GetInfo() (result ArchiveInfo, err error) {
+	result.Meta = a.Meta
+	result.Images = GetImageInfo(a.Manifests, a.GetLayer)
+	for i, m := range a.Manifests {
+		var config ImageConfig
+		if config, err = a.GetImageConfig(m); err != nil {
+			return
+		}
+		result.Images[i].Created = config.Created
+		result.Images[i].Architecture = config.Architecture
+	}
+
+	for _, f := range a.reader.File {
+		if strings.HasPrefix(f.Name, dizPrefix) {
+			result.Size += int64(f.UncompressedSize64)
+			result.CompressedSize += int64(f.FileHeader.CompressedSize64)
+		}
+	}
+	if result.CompressedSize > 0 {
+		result.Ratio = float64(result.Size) / float64(result.CompressedSize)
+	}
+
+	return
+}
+
+// GetImageInfo returns the size accounting of the images with the given manifests
+func GetImageInfo(manifests []Manifest, layer LayerFunc) (result []ImageInfo) {
+	// users counts the images referencing every layer hash
+	users := make(map[string]int, 0)
+	for _, m := range manifests {
+		for _, l := range getLayers([]Manifest{m}, layer) {
+			users[l.Hash]++
+		}
+	}
+
+	for _, m := range manifests {
+		info := ImageInfo{Config: m.Config, RepoTags: m.RepoTags, Layers: len(m.Layers)}
+		for _, l := range getLayers([]Manifest{m}, layer) {
+			info.Size += l.Size
+			info.CompressedSize += l.CompressedSize
+			if users[l.Hash] == 1 {
+				info.UniqueSize += l.Size
+			} else {
+				info.SharedSize += l.Size
+			}
+		}
+		result = append(result, info)
+	}
+
+	return
+}
+
+// GetLayerTags returns the tags of the images referencing the layer. The layer is given by a prefix of its layer
+// directory or its content hash
+func (a *Archive) GetLayerTags(layer string) (result []string) {
+	return GetLayerTags(a.Manifests, a.GetLayer, layer)
+}
+
+// GetLayerTags returns the tags of the manifests referencing the layer. The layer is given by a prefix of its layer
+// directory or its content hash
+func GetLayerTags(manifests []Manifest, layer LayerFunc, prefix string) (result []string) {
+	prefix = strings.TrimPrefix(prefix, "sha256:")
+	if prefix == "" {
+		return
+	}
+	for _, m := range manifests {
+		for _, name := range m.Layers {
+			if strings.HasPrefix(name, prefix) || strings.HasPrefix(layer(name).Hash, prefix) {
+				result = append(result, m.RepoTags...)
+				break
+			}
+		}
+	}
+
+	return
+}
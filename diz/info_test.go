@@ -0,0 +1,29 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageInfo(t *testing.T) {
+	layers := map[string]Layer{
+		"x/layer.tar": {Hash: "hx", Size: 100, CompressedSize: 10},
+		"y/layer.tar": {Hash: "hy", Size: 200, CompressedSize: 20},
+		"z/layer.tar": {Hash: "hz", Size: 300, CompressedSize: 30},
+	}
+	layer := func(name string) Layer { return layers[name] }
+	manifests := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar", "y/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:1.1", "app:latest"}, Layers: []string{"x/layer.tar", "z/layer.tar"}},
+	}
+
+	assert.Equal(t, []ImageInfo{
+		{Config: "a.json", RepoTags: manifests[0].RepoTags, Layers: 2, Size: 300, CompressedSize: 30, UniqueSize: 200, SharedSize: 100},
+		{Config: "b.json", RepoTags: manifests[1].RepoTags, Layers: 2, Size: 400, CompressedSize: 40, UniqueSize: 300, SharedSize: 100},
+	}, GetImageInfo(manifests, layer))
+
+	assert.Equal(t, []string{"app:1.0", "app:1.1", "app:latest"}, GetLayerTags(manifests, layer, "x"))
+	assert.Equal(t, []string{"app:1.1", "app:latest"}, GetLayerTags(manifests, layer, "sha256:hz"))
+	assert.Nil(t, GetLayerTags(manifests, layer, "q"))
+}
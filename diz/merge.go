@@ -0,0 +1,123 @@
+package diz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/JohanLindvall/diz/str"
+)
+
+const (
+	// ConflictFirst resolves tag conflicts using the first manifest set containing the tag
+	ConflictFirst = "first"
+	// ConflictLast resolves tag conflicts using the last manifest set containing the tag
+	ConflictLast = "last"
+	// ConflictFail fails on tag conflicts
+	ConflictFail = "fail"
+)
+
+// TagConflict describes a tag referring to different configs in different manifest sets
+type TagConflict struct {
+	Tag     string
+	Configs []string
+	// Winner is the index of the manifest set whose config is used for the tag
+	Winner int
+}
+
+type tagOwner struct {
+	set    int
+	config string
+}
+
+// ResolveConflicts resolves tags referring to different configs in the manifest sets according to the policy. The
+// tag is removed from the manifests of the losing sets, dropping manifests left without tags
+func ResolveConflicts(sets [][]Manifest, policy string) (result [][]Manifest, conflicts []TagConflict, err error) {
+	if policy != ConflictFirst && policy != ConflictLast && policy != ConflictFail {
+		err = fmt.Errorf("unknown conflict policy '%s'", policy)
+		return
+	}
+
+	owners := make(map[string][]tagOwner, 0)
+	var order []string
+	for i, set := range sets {
+		for _, m := range set {
+			for _, tag := range m.RepoTags {
+				key := dockerref.NormalizeReference(tag)
+				if _, ok := owners[key]; !ok {
+					order = append(order, key)
+				}
+				owners[key] = append(owners[key], tagOwner{set: i, config: m.Config})
+			}
+		}
+	}
+
+	// losers maps set index to the normalized tags to remove from the set
+	losers := make(map[int][]string, 0)
+	for _, key := range order {
+		o := owners[key]
+		var configs []string
+		for _, owner := range o {
+			if !str.StringInSlice(owner.config, configs) {
+				configs = append(configs, owner.config)
+			}
+		}
+		if len(configs) < 2 {
+			continue
+		}
+		winner := o[0]
+		if policy == ConflictLast {
+			winner = o[len(o)-1]
+		}
+		conflicts = append(conflicts, TagConflict{Tag: key, Configs: configs, Winner: winner.set})
+		for _, owner := range o {
+			if owner.config != winner.config {
+				losers[owner.set] = append(losers[owner.set], key)
+			}
+		}
+	}
+
+	if policy == ConflictFail && len(conflicts) > 0 {
+		var tags []string
+		for _, c := range conflicts {
+			tags = append(tags, c.Tag)
+		}
+		sort.Strings(tags)
+		err = fmt.Errorf("conflicting tags: %s", strings.Join(tags, ", "))
+		return
+	}
+
+	for i, set := range sets {
+		var resolved []Manifest
+		for _, m := range set {
+			mm := Manifest{Config: m.Config, Layers: m.Layers}
+			for _, tag := range m.RepoTags {
+				if !str.StringInSlice(dockerref.NormalizeReference(tag), losers[i]) {
+					mm.RepoTags = append(mm.RepoTags, tag)
+				}
+			}
+			if len(mm.RepoTags) > 0 {
+				resolved = append(resolved, mm)
+			}
+		}
+		result = append(result, resolved)
+	}
+
+	return
+}
+
+// GetDifferingFiles returns the names of the files in the archive, selected by the manifests, which exist in the zip writer with different contents
+func (a *Archive) GetDifferingFiles(zipWriter *hashzip.Writer, manifests []Manifest) (result []string) {
+	a.copyTo(func(zf *hashzip.File, fn string, contents []byte) error {
+		if zf != nil && zf.Hash != "" {
+			if h := zipWriter.GetHash(fn); h != "" && h != zf.Hash {
+				result = append(result, fn)
+			}
+		}
+		return nil
+	}, manifests, true, false)
+
+	return
+}
@@ -0,0 +1,30 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveConflicts(t *testing.T) {
+	a := Manifest{Config: "a.json", RepoTags: []string{"app:1.0", "app:latest"}, Layers: []string{"x/layer.tar"}}
+	b := Manifest{Config: "b.json", RepoTags: []string{"docker.io/library/app:latest"}, Layers: []string{"y/layer.tar"}}
+	c := Manifest{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar"}}
+	sets := [][]Manifest{{a}, {b, c}}
+
+	result, conflicts, err := ResolveConflicts(sets, ConflictFirst)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]Manifest{{a}, {c}}, result)
+	assert.Equal(t, []TagConflict{{Tag: "docker.io/library/app:latest", Configs: []string{"a.json", "b.json"}, Winner: 0}}, conflicts)
+
+	result, conflicts, err = ResolveConflicts(sets, ConflictLast)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]Manifest{{{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: a.Layers}}, {b, c}}, result)
+	assert.Equal(t, 1, conflicts[0].Winner)
+
+	_, _, err = ResolveConflicts(sets, ConflictFail)
+	assert.EqualError(t, err, "conflicting tags: docker.io/library/app:latest")
+
+	_, _, err = ResolveConflicts(sets, "other")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,112 @@
+package diz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/JohanLindvall/diz/str"
+)
+
+const (
+	metaJSON = "meta.json"
+	// FormatVersion is the archive format version written and the latest version read
+	FormatVersion = 1
+	// FeatureHashes marks archives with the sha256 hashes of the uncompressed files in .hashes
+	FeatureHashes = "hashes"
+	// FeatureDeflate marks archives with deflate compressed files
+	FeatureDeflate = "deflate"
+	// FeatureDedup marks archives storing the files shared by images once
+	FeatureDedup = "dedup"
+)
+
+// Features holds the format features supported by this version
+var Features = []string{FeatureHashes, FeatureDeflate, FeatureDedup}
+
+// Meta holds the metadata describing an archive
+type Meta struct {
+	FormatVersion int               `json:"formatVersion"`
+	Features      []string          `json:"features"`
+	Created       time.Time         `json:"created"`
+	Modified      time.Time         `json:"modified"`
+	ToolVersion   string            `json:"toolVersion"`
+	Source        *SourceInfo       `json:"source,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	KeepPrevious  int               `json:"keepPrevious,omitempty"`
+}
+
+// SourceInfo describes the Docker daemon the images were read from
+type SourceInfo struct {
+	Host         string `json:"host"`
+	Version      string `json:"version,omitempty"`
+	OS           string `json:"os,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+}
+
+// NewMeta returns the metadata of an archive created and modified now by the tool version
+func NewMeta(toolVersion string) *Meta {
+	now := time.Now().UTC()
+	return &Meta{FormatVersion: FormatVersion, Features: append([]string(nil), Features...), Created: now, Modified: now, ToolVersion: toolVersion, Labels: make(map[string]string, 0)}
+}
+
+// Validate returns an error if the archive uses a format version or features not supported by this version
+func (m *Meta) Validate() error {
+	if m.FormatVersion > FormatVersion {
+		return fmt.Errorf("archive format version %d is not supported, the latest supported version is %d (written by diz %s, upgrade diz to read it)", m.FormatVersion, FormatVersion, m.ToolVersion)
+	}
+	if unsupported := str.RemoveSlice(m.Features, Features); len(unsupported) > 0 {
+		return fmt.Errorf("archive features %s are not supported (written by diz %s, upgrade diz to read it)", strings.Join(unsupported, ", "), m.ToolVersion)
+	}
+
+	return nil
+}
+
+// GetLabels returns the label keys sorted
+func (m *Meta) GetLabels() (result []string) {
+	for k := range m.Labels {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	return
+}
+
+// readMeta reads the metadata of the archive, returning nil for archives written before it was introduced
+func readMeta(zipReader *hashzip.Reader) (*Meta, error) {
+	f := getDizFile(zipReader, metaJSON)
+	if f == nil {
+		return nil, nil
+	}
+	rdr, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	var meta Meta
+	if b, err := ioutil.ReadAll(rdr); err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", metaJSON, err)
+	}
+
+	return &meta, meta.Validate()
+}
+
+// WriteMeta writes the metadata to the zip writer
+func WriteMeta(meta *Meta, zipWriter *hashzip.Writer) error {
+	if b, err := json.Marshal(meta); err != nil {
+		return err
+	} else if entry, err := zipWriter.Create(dizPrefix + metaJSON); err != nil {
+		return err
+	} else {
+		_, err = io.Copy(entry, bytes.NewReader(b))
+		return err
+	}
+}
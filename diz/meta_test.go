@@ -0,0 +1,20 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaValidate(t *testing.T) {
+	meta := NewMeta("1.0")
+	assert.Nil(t, meta.Validate())
+	assert.Equal(t, FormatVersion, meta.FormatVersion)
+
+	meta.FormatVersion = FormatVersion + 1
+	assert.EqualError(t, meta.Validate(), "archive format version 2 is not supported, the latest supported version is 1 (written by diz 1.0, upgrade diz to read it)")
+
+	meta.FormatVersion = FormatVersion
+	meta.Features = append(meta.Features, "zstd")
+	assert.EqualError(t, meta.Validate(), "archive features zstd are not supported (written by diz 1.0, upgrade diz to read it)")
+}
@@ -0,0 +1,159 @@
+package diz
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/JohanLindvall/diz/dockerref"
+)
+
+const (
+	// previousSeparator separates the tag from the version number of the hidden tags of previous images
+	previousSeparator = "@prev"
+	// previousAliasPrefix prefixes the version number and the tag of the pullable aliases of hidden tags
+	previousAliasPrefix = "prev"
+)
+
+// PreviousTag returns the hidden tag of the nth previous image of the tag, e.g. "nginx:1.19@prev1"
+func PreviousTag(tag string, n int) string {
+	registry, repository, t := dockerref.SplitRegistryRepositoryTag(tag)
+	if t == "" {
+		t = latestTag
+	}
+	return dockerref.JoinRegistryRepositoryTag(registry, repository, t+previousSeparator+strconv.Itoa(n))
+}
+
+// IsPreviousTag returns true if the tag is the hidden tag of a previous image
+func IsPreviousTag(tag string) bool {
+	i := strings.LastIndex(tag, previousSeparator)
+	if i == -1 {
+		return false
+	}
+	n, err := strconv.Atoi(tag[i+len(previousSeparator):])
+	return err == nil && n > 0
+}
+
+// MatchesPrevious returns true if any of the glob expressions matches the hidden tags of previous images
+func MatchesPrevious(globTags []string) bool {
+	for _, globTag := range globTags {
+		if strings.Contains(globTag, previousSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviousAlias returns the alias of the hidden tag of a previous image which is a valid Docker reference, e.g.
+// "nginx:prev1-1.19" for "nginx:1.19@prev1"
+func PreviousAlias(tag string) string {
+	i := strings.LastIndex(tag, previousSeparator)
+	registry, repository, t := dockerref.SplitRegistryRepositoryTag(tag[:i])
+	if t == "" {
+		t = latestTag
+	}
+	return dockerref.JoinRegistryRepositoryTag(registry, repository, previousAliasPrefix+tag[i+len(previousSeparator):]+"-"+t)
+}
+
+// getPreviousConfigs returns the configs of the previous images of the normalized tag, the most recent first
+func getPreviousConfigs(tags map[string]string, tag string) (result []string) {
+	for n := 1; ; n++ {
+		if c, ok := tags[dockerref.NormalizeReference(PreviousTag(tag, n))]; ok {
+			result = append(result, c)
+		} else {
+			return
+		}
+	}
+}
+
+// KeepPrevious returns the manifests of the previous images of the tags in the new manifests, tagged with hidden tags.
+// The image a tag referred to in the old manifests becomes its first previous image when the tag is moved, keeping
+// at most keep previous images. If keep is negative, the number of previous images in the old manifests is kept
+func KeepPrevious(old, newManifests []Manifest, keep int) (result []Manifest) {
+	oldTags, oldConfigs := tagsToConfig(old)
+	for _, m := range newManifests {
+		for _, t := range m.RepoTags {
+			tag := dockerref.NormalizeReference(t)
+			previous := getPreviousConfigs(oldTags, tag)
+			depth := keep
+			if depth < 0 {
+				depth = len(previous)
+			}
+			if c, ok := oldTags[tag]; ok && c != m.Config {
+				previous = append([]string{c}, previous...)
+			}
+			n := 0
+			seen := map[string]bool{m.Config: true}
+			for _, c := range previous {
+				if o, ok := oldConfigs[c]; ok && !seen[c] && n < depth {
+					seen[c] = true
+					n++
+					result = MergeManifests(result, []Manifest{{Config: c, RepoTags: []string{PreviousTag(t, n)}, Layers: o.Layers}})
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// Rollback returns a copy of the manifests with the tag referring to its nth previous image. The image the tag referred
+// to becomes its first previous image, so the rollback can be undone by another one. The more recent previous images
+// are dropped, unless referenced by other tags. The tag is written as in the manifests
+func Rollback(manifests []Manifest, tag string, n int) (result []Manifest, err error) {
+	normalized := dockerref.NormalizeReference(tag)
+	tags, _ := tagsToConfig(manifests)
+	previous := getPreviousConfigs(tags, normalized)
+	if n < 1 || n > len(previous) {
+		return nil, fmt.Errorf("%s has no previous image %d", tag, n)
+	}
+
+	// Remove the tag and its hidden tags, then add them back
+	name := ""
+	for _, m := range manifests {
+		mm := Manifest{Config: m.Config, Layers: m.Layers}
+		for _, t := range m.RepoTags {
+			if base := strings.Split(t, previousSeparator)[0]; !dockerref.CompareReferences(base, tag) {
+				mm.RepoTags = append(mm.RepoTags, t)
+			} else if name == "" || t == base {
+				name = base
+			}
+		}
+		result = append(result, mm)
+	}
+	addTag(result, previous[n-1], name)
+	var kept []string
+	if c, ok := tags[normalized]; ok {
+		kept = append(kept, c)
+	}
+	seen := map[string]bool{previous[n-1]: true}
+	for _, c := range append(kept, previous[n:]...) {
+		if !seen[c] {
+			seen[c] = true
+			addTag(result, c, PreviousTag(name, len(seen)-1))
+		}
+	}
+
+	return removeUntagged(result), nil
+}
+
+// addTag adds the tag to the manifest with the config
+func addTag(manifests []Manifest, config, tag string) {
+	for i := range manifests {
+		if manifests[i].Config == config {
+			manifests[i].RepoTags = append(manifests[i].RepoTags, tag)
+			return
+		}
+	}
+}
+
+// removeUntagged returns the manifests with tags
+func removeUntagged(manifests []Manifest) (result []Manifest) {
+	for _, m := range manifests {
+		if len(m.RepoTags) > 0 {
+			result = append(result, m)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,76 @@
+package diz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepPrevious(t *testing.T) {
+	old := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1"}, Layers: []string{"x/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:2"}, Layers: []string{"y/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"app:1@prev1"}, Layers: []string{"z/layer.tar"}},
+		{Config: "e.json", RepoTags: []string{"app:1@prev2", "app:1@prev3"}, Layers: []string{"v/layer.tar"}},
+	}
+	newManifests := []Manifest{
+		{Config: "d.json", RepoTags: []string{"app:1"}, Layers: []string{"w/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:2"}, Layers: []string{"y/layer.tar"}},
+	}
+
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1@prev1"}, Layers: []string{"x/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"app:1@prev2"}, Layers: []string{"z/layer.tar"}},
+		{Config: "e.json", RepoTags: []string{"app:1@prev3"}, Layers: []string{"v/layer.tar"}},
+	}, KeepPrevious(old, newManifests, 5))
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1@prev1"}, Layers: []string{"x/layer.tar"}},
+	}, KeepPrevious(old, newManifests, 1))
+	assert.Nil(t, KeepPrevious(old, newManifests[1:], 2))
+
+	assert.Equal(t, 3, len(KeepPrevious(old, newManifests, -1)))
+	assert.Nil(t, KeepPrevious(old, newManifests, 0))
+
+	tags := []string{"app:1", "app:1@prev1"}
+	assert.Equal(t, []string{"app:1"}, FilterImageTags(tags, nil, []string{"app:*"}))
+	assert.Equal(t, []string{"app:1@prev1"}, FilterImageTags(tags, nil, []string{"app:*@prev*"}))
+	assert.Equal(t, "app:prev2-1", PreviousAlias("app:1@prev2"))
+	assert.Equal(t, "quay.io/org/app:prev1-latest", PreviousAlias("quay.io/org/app@prev1"))
+	assert.Equal(t, []Manifest{{Config: "b.json", RepoTags: []string{"app:2"}, Layers: []string{"y/layer.tar"}}}, RemoveTags(old, []string{"app:1"}))
+}
+
+func TestRollback(t *testing.T) {
+	manifests := []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1", "app:latest"}, Layers: []string{"x/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:1@prev1"}, Layers: []string{"y/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"app:1@prev2"}, Layers: []string{"z/layer.tar"}},
+	}
+
+	// The replaced image becomes the first previous image, the tag is written as in the manifests
+	result, err := Rollback(manifests, "docker.io/library/app:1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:latest", "app:1@prev1"}, Layers: []string{"x/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:1"}, Layers: []string{"y/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"app:1@prev2"}, Layers: []string{"z/layer.tar"}},
+	}, result)
+
+	// Rolling back again undoes the rollback
+	undone, err := Rollback(result, "app:1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:latest", "app:1"}, Layers: []string{"x/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:1@prev1"}, Layers: []string{"y/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"app:1@prev2"}, Layers: []string{"z/layer.tar"}},
+	}, undone)
+
+	result, err = Rollback(manifests, "app:1", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:latest", "app:1@prev1"}, Layers: []string{"x/layer.tar"}},
+		{Config: "c.json", RepoTags: []string{"app:1"}, Layers: []string{"z/layer.tar"}},
+	}, result)
+
+	_, err = Rollback(manifests, "app:latest", 1)
+	assert.EqualError(t, err, "app:latest has no previous image 1")
+}
@@ -0,0 +1,215 @@
+package diz
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/JohanLindvall/diz/hashzip"
+)
+
+// RepairResult holds the outcome of repairing an archive
+type RepairResult struct {
+	Manifests  []Manifest
+	Dropped    []string
+	Rebuilt    int
+	Untagged   int
+	Incomplete []string
+	// Meta is the metadata of the archive, if readable
+	Meta    *Meta
+	History []HistoryEntry
+}
+
+// RepairArchive copies the readable files of the zip archive referenced by the repaired manifests to the zip writer,
+// recomputing their hashes. The manifests of manifest.json referring to present files are kept, and the manifests of
+// the remaining image configs are rebuilt from the layers, recovering the tags from the repositories file. Unreadable
+// and corrupt files are dropped. The manifests are not written
+func RepairArchive(zipReader *hashzip.Reader, zipWriter *hashzip.Writer) (result RepairResult, err error) {
+	var manifests []Manifest
+	var r repositories
+	configs := make(map[string][]string, 0)
+	layers := make(map[string]string, 0)
+	readable := make(map[string]bool, 0)
+
+	for _, f := range zipReader.File {
+		name := strings.TrimPrefix(f.Name, dizPrefix)
+		var contents []byte
+		if contents, f.Hash, err = readHashed(f, isArchiveFile(name) || isConfig(f.Name)); err != nil {
+			result.Dropped = append(result.Dropped, f.Name)
+			err = nil
+			continue
+		}
+		readable[f.Name] = true
+
+		var corrupt error
+		switch {
+		case f.Name == dizPrefix+manifestJSON:
+			// The manifests of a corrupt manifest.json are rebuilt from the configs
+			if corrupt = json.Unmarshal(contents, &manifests); corrupt != nil {
+				manifests = nil
+			}
+		case f.Name == dizPrefix+repos:
+			if corrupt = json.Unmarshal(contents, &r); corrupt != nil {
+				r = nil
+			}
+		case f.Name == dizPrefix+metaJSON:
+			var meta Meta
+			if corrupt = json.Unmarshal(contents, &meta); corrupt == nil {
+				result.Meta = &meta
+			}
+		case f.Name == dizPrefix+historyJSON:
+			if corrupt = json.Unmarshal(contents, &result.History); corrupt != nil {
+				result.History = nil
+			}
+		case isConfig(f.Name):
+			var config ImageConfig
+			if json.Unmarshal(contents, &config) == nil && len(config.RootFS.DiffIDs) > 0 {
+				configs[name] = config.RootFS.DiffIDs
+			}
+		case strings.HasPrefix(f.Name, dizPrefix) && strings.HasSuffix(f.Name, layersTarSuffix):
+			layers[name] = f.Hash
+		}
+		if corrupt != nil {
+			result.Dropped = append(result.Dropped, f.Name)
+		}
+	}
+
+	for _, m := range manifests {
+		if isComplete(m, configs, layers) {
+			result.Manifests = append(result.Manifests, m)
+			delete(configs, m.Config)
+		}
+	}
+
+	var rebuilt []Manifest
+	rebuilt, result.Incomplete = RebuildManifests(configs, layers, r)
+	result.Rebuilt = len(rebuilt)
+	for _, m := range rebuilt {
+		if len(m.RepoTags) == 0 {
+			result.Untagged++
+		}
+	}
+	result.Manifests = append(result.Manifests, rebuilt...)
+
+	// Copy the configs and the layer directories referenced by the manifests
+	referenced := make(map[string]bool, 0)
+	for _, m := range result.Manifests {
+		referenced[m.Config] = true
+		for _, l := range m.Layers {
+			referenced[strings.TrimSuffix(l, layersTarSuffix)] = true
+		}
+	}
+	for _, f := range zipReader.File {
+		name := strings.TrimPrefix(f.Name, dizPrefix)
+		if readable[f.Name] && !isArchiveFile(name) && (referenced[name] || referenced[path.Dir(name)]) && !zipWriter.Exists(f.Name) {
+			if err = zipWriter.Copy(f.Name, f); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// RebuildManifests returns the manifests of the image configs, given by their diff ids, from the layers, given by their
+// content hashes. The tags are recovered from the repositories by the top layer. Configs with missing layers are
+// returned as incomplete
+func RebuildManifests(configs map[string][]string, layers map[string]string, r map[string]map[string]string) (result []Manifest, incomplete []string) {
+	var layerNames []string
+	for name := range layers {
+		layerNames = append(layerNames, name)
+	}
+	sort.Strings(layerNames)
+	byHash := make(map[string]string, 0)
+	for _, name := range layerNames {
+		if _, ok := byHash[layers[name]]; !ok {
+			byHash[layers[name]] = name
+		}
+	}
+
+	var configNames []string
+	for name := range configs {
+		configNames = append(configNames, name)
+	}
+	sort.Strings(configNames)
+
+	for _, config := range configNames {
+		m := Manifest{Config: config, RepoTags: []string{}}
+		for _, diffID := range configs[config] {
+			if name, ok := byHash[strings.TrimPrefix(diffID, "sha256:")]; ok {
+				m.Layers = append(m.Layers, name)
+			} else {
+				m.Layers = nil
+				break
+			}
+		}
+		if m.Layers == nil {
+			incomplete = append(incomplete, config)
+			continue
+		}
+
+		top := strings.TrimPrefix(configs[config][len(configs[config])-1], "sha256:")
+		for repo, tags := range r {
+			for tag, id := range tags {
+				if layers[id+layersTarSuffix] == top {
+					m.RepoTags = append(m.RepoTags, repo+":"+tag)
+				}
+			}
+		}
+		sort.Strings(m.RepoTags)
+		result = append(result, m)
+	}
+
+	return
+}
+
+// isConfig returns true if the zip entry name is an image config
+func isConfig(name string) bool {
+	if !strings.HasPrefix(name, dizPrefix) {
+		return false
+	}
+	name = name[len(dizPrefix):]
+	return !isArchiveFile(name) && strings.HasSuffix(name, dotJSON) && !strings.Contains(name, "/")
+}
+
+// isComplete returns true if the config and all layers of the manifest are present
+func isComplete(m Manifest, configs map[string][]string, layers map[string]string) bool {
+	if _, ok := configs[m.Config]; !ok || len(m.Layers) == 0 {
+		return false
+	}
+	for _, l := range m.Layers {
+		if _, ok := layers[l]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readHashed reads the zip file, returning its content hash and, if keep is set, its contents
+func readHashed(f *hashzip.File, keep bool) (contents []byte, hash string, err error) {
+	var rdr io.ReadCloser
+	if rdr, err = f.Open(); err != nil {
+		return
+	}
+	defer rdr.Close()
+
+	h := sha256.New()
+	if keep {
+		if contents, err = ioutil.ReadAll(rdr); err == nil {
+			h.Write(contents)
+		}
+	} else {
+		_, err = io.Copy(h, rdr)
+	}
+	if err == nil {
+		hash = fmt.Sprintf("%x", h.Sum(nil))
+	}
+
+	return
+}
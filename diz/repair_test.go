@@ -0,0 +1,79 @@
+package diz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebuildManifests(t *testing.T) {
+	configs := map[string][]string{
+		"a.json": {"sha256:hx", "sha256:hy"},
+		"b.json": {"sha256:hx", "sha256:hz"},
+		"c.json": {"sha256:hq"},
+	}
+	layers := map[string]string{
+		"x/layer.tar": "hx",
+		"y/layer.tar": "hy",
+		"z/layer.tar": "hz",
+	}
+	r := map[string]map[string]string{
+		"app":   {"1.0": "y", "latest": "z"},
+		"other": {"1.1": "z"},
+	}
+
+	result, incomplete := RebuildManifests(configs, layers, r)
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar", "y/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:latest", "other:1.1"}, Layers: []string{"x/layer.tar", "z/layer.tar"}},
+	}, result)
+	assert.Equal(t, []string{"c.json"}, incomplete)
+
+	result, _ = RebuildManifests(configs, layers, nil)
+	assert.Equal(t, []string{}, result[0].RepoTags)
+}
+
+// writeArchive returns a zip archive with the files, given as name and contents pairs
+func writeArchive(t *testing.T, files ...string) *hashzip.Reader {
+	var buf bytes.Buffer
+	zipWriter := hashzip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zipWriter.Create(files[i])
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(files[i+1]))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, zipWriter.Close())
+	zipReader, err := hashzip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	return zipReader
+}
+
+func TestRepairArchive(t *testing.T) {
+	diffID := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("x")))
+	zipReader := writeArchive(t,
+		".diz/a.json", `{"rootfs":{"type":"layers","diff_ids":["`+diffID+`"]}}`,
+		".diz/x/VERSION", "1.0",
+		".diz/x/layer.tar", "x",
+		".diz/orphan/layer.tar", "y",
+		".diz/manifest.json", `[{"Config":"a.json","RepoTags":["app:1.0"],"Layers":["x/layer.tar"]`,
+		".diz/repositories", `{"app":{"1.0":"x"}}`,
+	)
+
+	var buf bytes.Buffer
+	zipWriter := hashzip.NewWriter(&buf)
+	result, err := RepairArchive(zipReader, zipWriter)
+	assert.Nil(t, err)
+	// The corrupt manifest.json is dropped and the manifest rebuilt, the orphan layer is not copied
+	assert.Equal(t, []string{".diz/manifest.json"}, result.Dropped)
+	assert.Equal(t, []Manifest{{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar"}}}, result.Manifests)
+	assert.Equal(t, 1, result.Rebuilt)
+	assert.True(t, zipWriter.Exists(".diz/x/VERSION"))
+	assert.True(t, zipWriter.Exists(".diz/a.json"))
+	assert.False(t, zipWriter.Exists(".diz/orphan/layer.tar"))
+	assert.False(t, zipWriter.Exists(".diz/repositories"))
+}
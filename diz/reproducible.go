@@ -0,0 +1,55 @@
+package diz
+
+import (
+	"sort"
+
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/JohanLindvall/diz/str"
+)
+
+// SortManifests returns a copy of the manifests sorted by config, with the tags sorted
+func SortManifests(manifests []Manifest) (result []Manifest) {
+	for _, m := range manifests {
+		tags := append([]string(nil), m.RepoTags...)
+		sort.Strings(tags)
+		result = append(result, Manifest{Config: m.Config, RepoTags: tags, Layers: m.Layers})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Config < result[j].Config })
+
+	return
+}
+
+// CopySorted copies the archive to the zip writer with the files sorted by name, followed by the sorted manifests, the
+// metadata and the history. The files are copied without recompressing
+func CopySorted(zipReader *hashzip.Reader, zipWriter *hashzip.Writer) error {
+	manifests, err := readManifest(zipReader)
+	if err != nil {
+		return err
+	}
+
+	var files []*hashzip.File
+	for _, f := range zipReader.File {
+		if str.IndexOf(ManifestFiles(), f.Name) == -1 {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	for _, f := range files {
+		if err = zipWriter.Copy(f.Name, f); err != nil {
+			return err
+		}
+	}
+
+	if err = WriteManifests(SortManifests(manifests), zipWriter); err != nil {
+		return err
+	}
+	for _, name := range []string{metaJSON, historyJSON} {
+		if f := getDizFile(zipReader, name); f != nil {
+			if err = zipWriter.Copy(f.Name, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
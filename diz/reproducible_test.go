@@ -0,0 +1,49 @@
+package diz
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortManifests(t *testing.T) {
+	manifests := []Manifest{
+		{Config: "b.json", RepoTags: []string{"app:2", "app:1"}, Layers: []string{"y/layer.tar", "x/layer.tar"}},
+		{Config: "a.json", RepoTags: []string{"other:1"}, Layers: []string{"x/layer.tar"}},
+	}
+
+	assert.Equal(t, []Manifest{
+		{Config: "a.json", RepoTags: []string{"other:1"}, Layers: []string{"x/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:1", "app:2"}, Layers: []string{"y/layer.tar", "x/layer.tar"}},
+	}, SortManifests(manifests))
+	assert.Equal(t, []string{"app:2", "app:1"}, manifests[0].RepoTags)
+}
+
+func TestCopySorted(t *testing.T) {
+	files := [][]string{
+		{".diz/a.json", "{}"},
+		{".diz/x/layer.tar", "x"},
+		{".diz/y/layer.tar", "y"},
+		{".diz/manifest.json", `[{"Config":"a.json","RepoTags":["b:1","a:1"],"Layers":["x/layer.tar","y/layer.tar"]}]`},
+	}
+	var sorted [][]byte
+	for _, order := range [][]int{{0, 1, 2, 3}, {2, 0, 1, 3}} {
+		var args []string
+		for _, i := range order {
+			args = append(args, files[i]...)
+		}
+		zipReader := writeArchive(t, args...)
+
+		var buf bytes.Buffer
+		zipWriter := hashzip.NewWriter(&buf)
+		zipWriter.SetModified(time.Unix(1600000000, 0).UTC())
+		assert.Nil(t, CopySorted(zipReader, zipWriter))
+		assert.Nil(t, zipWriter.Close())
+		sorted = append(sorted, buf.Bytes())
+	}
+
+	assert.Equal(t, sorted[0], sorted[1])
+}
@@ -0,0 +1,40 @@
+package diz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeAfterManifests(t *testing.T) {
+	f, err := ioutil.TempFile("", "diz-resume")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// The manifest is written, then the create is interrupted before the central directory
+	manifests := []Manifest{{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar"}}}
+	zipWriter := hashzip.NewWriter(f)
+	for _, name := range []string{"a.json", "x/layer.tar"} {
+		assert.Nil(t, WriteEntry(zipWriter, name, bytes.NewReader([]byte(name))))
+	}
+	assert.Nil(t, WriteManifests(manifests, zipWriter))
+	assert.Nil(t, zipWriter.Flush())
+
+	zipWriter, err = hashzip.NewResumeWriterLevel(f, 1, ManifestFiles())
+	assert.Nil(t, err)
+	assert.True(t, zipWriter.Exists(EntryName("x/layer.tar")))
+	assert.False(t, zipWriter.Exists(EntryName(manifestJSON)))
+	assert.Nil(t, WriteManifests(manifests, zipWriter))
+	assert.Nil(t, zipWriter.Close())
+
+	fi, err := f.Stat()
+	assert.Nil(t, err)
+	a, err := NewArchive(f, fi.Size())
+	assert.Nil(t, err)
+	assert.Equal(t, manifests, a.Manifests)
+}
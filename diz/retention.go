@@ -0,0 +1,159 @@
+package diz
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JohanLindvall/diz/dockerref"
+)
+
+// RetentionPolicy defines which tags to keep per repository. A tag is kept if any of the rules match it
+type RetentionPolicy struct {
+	// KeepLast keeps the given number of most recent tags
+	KeepLast int
+	// KeepWithin keeps tags of images created within the duration
+	KeepWithin time.Duration
+	// KeepLatestMinor keeps the highest patch version of every major.minor semantic version and every tag which is not a semantic version
+	KeepLatestMinor bool
+}
+
+// TaggedImage holds the information about a tag used for applying retention policies
+type TaggedImage struct {
+	Tag     string
+	Created time.Time
+	// Pinned tags are always kept and ordered before other tags
+	Pinned bool
+}
+
+// IsEmpty returns true if the policy has no rules, keeping every tag
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.KeepLast <= 0 && p.KeepWithin <= 0 && !p.KeepLatestMinor
+}
+
+// Apply applies the policy to the tagged images, returning the tags to remove
+func (p RetentionPolicy) Apply(images []TaggedImage, now time.Time) (remove []string) {
+	if p.IsEmpty() {
+		return
+	}
+
+	repositories := make(map[string][]TaggedImage, 0)
+	var order []string
+	for _, image := range images {
+		registry, repository, _ := dockerref.SplitRegistryRepositoryTag(image.Tag)
+		key := dockerref.JoinRegistryRepositoryTag(registry, repository, "")
+		if _, ok := repositories[key]; !ok {
+			order = append(order, key)
+		}
+		repositories[key] = append(repositories[key], image)
+	}
+
+	for _, key := range order {
+		repository := repositories[key]
+		sort.SliceStable(repository, func(i, j int) bool { return newer(repository[i], repository[j]) })
+
+		latestMinor := make(map[string]TaggedImage, 0)
+		if p.KeepLatestMinor {
+			for _, image := range repository {
+				if v, ok := parseSemver(getTag(image.Tag)); ok {
+					minor := strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1])
+					if l, ok := latestMinor[minor]; !ok || compareSemver(getTag(image.Tag), getTag(l.Tag)) > 0 {
+						latestMinor[minor] = image
+					}
+				}
+			}
+		}
+
+		for i, image := range repository {
+			keep := image.Pinned || (p.KeepLast > 0 && i < p.KeepLast) || (p.KeepWithin > 0 && !image.Created.IsZero() && now.Sub(image.Created) <= p.KeepWithin)
+			if p.KeepLatestMinor {
+				v, ok := parseSemver(getTag(image.Tag))
+				keep = keep || !ok || latestMinor[strconv.Itoa(v[0])+"."+strconv.Itoa(v[1])].Tag == image.Tag
+			}
+			if !keep {
+				remove = append(remove, image.Tag)
+			}
+		}
+	}
+
+	return
+}
+
+// newer returns true if image a is ordered before image b: pinned first, then by creation time and then by tag, descending
+func newer(a, b TaggedImage) bool {
+	if a.Pinned != b.Pinned {
+		return a.Pinned
+	}
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	return compareSemver(getTag(a.Tag), getTag(b.Tag)) > 0
+}
+
+func getTag(ref string) string {
+	_, _, tag := dockerref.SplitRegistryRepositoryTag(ref)
+	return tag
+}
+
+// parseSemver parses the major, minor and patch version of a semantic version with an optional 'v' prefix. Missing minor and patch versions are zero
+func parseSemver(tag string) (result [3]int, ok bool) {
+	tag = strings.TrimPrefix(tag, "v")
+	if i := strings.IndexAny(tag, "-+"); i != -1 {
+		tag = tag[:i]
+	}
+	parts := strings.Split(tag, ".")
+	if len(parts) > 3 {
+		return
+	}
+	for i, part := range parts {
+		var err error
+		if result[i], err = strconv.Atoi(part); err != nil || result[i] < 0 {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+// compareSemver compares the tags as semantic versions, where a pre-release orders before the release. Tags which are not semantic versions order before semantic versions and are compared as strings
+func compareSemver(a, b string) int {
+	va, oka := parseSemver(a)
+	vb, okb := parseSemver(b)
+	if oka != okb {
+		if oka {
+			return 1
+		}
+		return -1
+	}
+	if oka {
+		for i := range va {
+			if va[i] != vb[i] {
+				if va[i] > vb[i] {
+					return 1
+				}
+				return -1
+			}
+		}
+		preA, preB := strings.Contains(a, "-"), strings.Contains(b, "-")
+		if preA != preB {
+			if preB {
+				return 1
+			}
+			return -1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// ParseAge parses a duration, additionally supporting the day ('d') and week ('w') units, e.g. "30d"
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			if n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64); err == nil {
+				return time.Duration(n * float64(unit)), nil
+			}
+		}
+	}
+	return time.ParseDuration(s)
+}
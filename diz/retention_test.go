@@ -0,0 +1,54 @@
+package diz
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return now.AddDate(0, 0, -d) }
+	images := []TaggedImage{
+		{Tag: "app:1.0.0", Created: day(100)},
+		{Tag: "app:1.0.1", Created: day(90)},
+		{Tag: "app:1.1.0", Created: day(40)},
+		{Tag: "app:1.1.1", Created: day(20)},
+		{Tag: "app:1.2.0-rc1", Created: day(5)},
+		{Tag: "app:nightly", Created: day(1)},
+		{Tag: "app:1.2.0", Created: day(2), Pinned: true},
+		{Tag: "gcr.io/other/db:5", Created: day(400)},
+	}
+	apply := func(p RetentionPolicy) []string {
+		remove := p.Apply(append([]TaggedImage(nil), images...), now)
+		sort.Strings(remove)
+		return remove
+	}
+
+	assert.Nil(t, apply(RetentionPolicy{}))
+	assert.Equal(t, []string{"app:1.0.0", "app:1.0.1", "app:1.1.0", "app:1.1.1"}, apply(RetentionPolicy{KeepLast: 3}))
+	assert.Equal(t, []string{"app:1.0.0", "app:1.0.1", "app:1.1.0", "gcr.io/other/db:5"}, apply(RetentionPolicy{KeepWithin: 30 * 24 * time.Hour}))
+	// The pinned 1.2.0 is the latest 1.2 version, replacing the release candidate. Tags which are not semantic versions are kept
+	assert.Equal(t, []string{"app:1.0.0", "app:1.1.0", "app:1.2.0-rc1"}, apply(RetentionPolicy{KeepLatestMinor: true}))
+	assert.Equal(t, []string{"app:1.0.0", "app:1.1.0"}, apply(RetentionPolicy{KeepLast: 1, KeepWithin: 7 * 24 * time.Hour, KeepLatestMinor: true}))
+}
+
+func TestCompareSemver(t *testing.T) {
+	assert.Equal(t, 1, compareSemver("1.10.0", "1.9.3"))
+	assert.Equal(t, 1, compareSemver("v2", "1.9"))
+	assert.Equal(t, -1, compareSemver("1.2.0-rc1", "1.2.0"))
+	assert.Equal(t, -1, compareSemver("latest", "0.1"))
+	assert.Equal(t, 0, compareSemver("1.2.3", "1.2.3"))
+}
+
+func TestParseAge(t *testing.T) {
+	for s, expected := range map[string]time.Duration{"30d": 30 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "36h": 36 * time.Hour} {
+		d, err := ParseAge(s)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, d)
+	}
+	_, err := ParseAge("x")
+	assert.NotNil(t, err)
+}
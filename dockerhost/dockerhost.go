@@ -0,0 +1,154 @@
+package dockerhost
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+const (
+	defaultContext = "default"
+	dockerEndpoint = "docker"
+	caPem          = "ca.pem"
+	certPem        = "cert.pem"
+	keyPem         = "key.pem"
+)
+
+// Endpoint defines a Docker daemon endpoint. The zero value selects the endpoint from the environment
+type Endpoint struct {
+	Host          string
+	CACert        string
+	Cert          string
+	Key           string
+	SkipTLSVerify bool
+}
+
+// TLSOptions defines the TLS files used when connecting to an explicit host
+type TLSOptions struct {
+	CACert string
+	Cert   string
+	Key    string
+}
+
+type contextMeta struct {
+	Name      string
+	Endpoints map[string]struct {
+		Host          string
+		SkipTLSVerify bool
+	}
+}
+
+// ConfigDir returns the Docker configuration directory
+func ConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".docker")
+	}
+	return ".docker"
+}
+
+// CurrentContext returns the name of the current Docker context, from the DOCKER_CONTEXT environment variable or the Docker config
+func CurrentContext(configDir string) string {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(configDir, "config.json")); err == nil {
+		if err = json.Unmarshal(b, &config); err == nil && config.CurrentContext != "" {
+			return config.CurrentContext
+		}
+	}
+	return defaultContext
+}
+
+// GetContextEndpoint reads the Docker endpoint of the named context from the contexts metadata in the config directory
+func GetContextEndpoint(configDir, name string) (e Endpoint, err error) {
+	if name == defaultContext {
+		return
+	}
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+	var b []byte
+	if b, err = ioutil.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json")); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("docker context '%s' not found", name)
+		}
+		return
+	}
+	var meta contextMeta
+	if err = json.Unmarshal(b, &meta); err != nil {
+		return
+	}
+	endpoint, ok := meta.Endpoints[dockerEndpoint]
+	if !ok {
+		err = fmt.Errorf("docker context '%s' has no docker endpoint", name)
+		return
+	}
+	e.Host = endpoint.Host
+	e.SkipTLSVerify = endpoint.SkipTLSVerify
+
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, dockerEndpoint)
+	for fn, field := range map[string]*string{caPem: &e.CACert, certPem: &e.Cert, keyPem: &e.Key} {
+		if p := filepath.Join(tlsDir, fn); fileExists(p) {
+			*field = p
+		}
+	}
+
+	return
+}
+
+// Resolve resolves the Docker endpoint. A host (with the TLS options) takes precedence over a context name. Without
+// either, DOCKER_HOST, DOCKER_CONTEXT and the current context of the Docker config are used, in that order
+func Resolve(host, contextName string, tls TLSOptions) (Endpoint, error) {
+	if host != "" {
+		return Endpoint{Host: host, CACert: tls.CACert, Cert: tls.Cert, Key: tls.Key}, nil
+	}
+	if contextName == "" {
+		if os.Getenv("DOCKER_HOST") != "" {
+			return Endpoint{}, nil
+		}
+		contextName = CurrentContext(ConfigDir())
+	}
+	return GetContextEndpoint(ConfigDir(), contextName)
+}
+
+// ResolveSpec resolves the Docker endpoint from a specification which is either a host URL (containing "://") or a context name
+func ResolveSpec(spec string, tls TLSOptions) (Endpoint, error) {
+	if strings.Contains(spec, "://") {
+		return Resolve(spec, "", tls)
+	}
+	return Resolve("", spec, tls)
+}
+
+// NewClient creates a Docker client for the endpoint
+func NewClient(e Endpoint) (*client.Client, error) {
+	opts := []client.Opt{client.FromEnv}
+	if e.Host != "" {
+		transport := &http.Transport{}
+		if e.CACert != "" || e.Cert != "" || e.Key != "" || e.SkipTLSVerify {
+			tlsc, err := tlsconfig.Client(tlsconfig.Options{CAFile: e.CACert, CertFile: e.Cert, KeyFile: e.Key, InsecureSkipVerify: e.SkipTLSVerify})
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsc
+		}
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: transport, CheckRedirect: client.CheckRedirect}), client.WithHost(e.Host))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+func fileExists(fn string) bool {
+	_, err := os.Stat(fn)
+	return err == nil
+}
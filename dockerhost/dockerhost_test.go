@@ -0,0 +1,57 @@
+package dockerhost
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, fn, contents string) {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(fn), 0755))
+	assert.Nil(t, ioutil.WriteFile(fn, []byte(contents), 0644))
+}
+
+func TestContexts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerhost")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	if old, ok := os.LookupEnv("DOCKER_CONTEXT"); ok {
+		defer os.Setenv("DOCKER_CONTEXT", old)
+	}
+	os.Unsetenv("DOCKER_CONTEXT")
+
+	assert.Equal(t, "default", CurrentContext(dir))
+	writeFile(t, filepath.Join(dir, "config.json"), `{"auths":{},"currentContext":"remote"}`)
+	assert.Equal(t, "remote", CurrentContext(dir))
+
+	_, err = GetContextEndpoint(dir, "remote")
+	assert.EqualError(t, err, "docker context 'remote' not found")
+
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte("remote")))
+	writeFile(t, filepath.Join(dir, "contexts", "meta", id, "meta.json"), `{"Name":"remote","Metadata":{},"Endpoints":{"docker":{"Host":"tcp://build1:2376","SkipTLSVerify":false}}}`)
+	writeFile(t, filepath.Join(dir, "contexts", "tls", id, "docker", "ca.pem"), "ca")
+	writeFile(t, filepath.Join(dir, "contexts", "tls", id, "docker", "cert.pem"), "cert")
+
+	e, err := GetContextEndpoint(dir, "remote")
+	assert.Nil(t, err)
+	assert.Equal(t, Endpoint{
+		Host:   "tcp://build1:2376",
+		CACert: filepath.Join(dir, "contexts", "tls", id, "docker", "ca.pem"),
+		Cert:   filepath.Join(dir, "contexts", "tls", id, "docker", "cert.pem"),
+	}, e)
+
+	e, err = GetContextEndpoint(dir, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, Endpoint{}, e)
+}
+
+func TestResolveSpec(t *testing.T) {
+	e, err := ResolveSpec("tcp://build2:2376", TLSOptions{CACert: "ca.pem"})
+	assert.Nil(t, err)
+	assert.Equal(t, Endpoint{Host: "tcp://build2:2376", CACert: "ca.pem"}, e)
+}
@@ -0,0 +1,410 @@
+package hashzip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zip"
+)
+
+const (
+	hashesName         = ".hashes"
+	fileHeaderLen      = 30
+	fileHeaderSig      = 0x04034b50
+	directoryHeaderLen = 46
+	directoryHeaderSig = 0x02014b50
+	directoryEndLen    = 22
+	directoryEndSig    = 0x06054b50
+	directory64LocLen  = 20
+	directory64LocSig  = 0x07064b50
+	directory64EndLen  = 56
+	directory64EndSig  = 0x06064b50
+	uint16max          = 0xffff
+	zip64ExtraID       = 0x0001
+	zipVersion20       = 20
+	zipVersion45       = 45
+	// tailSuffix is appended to the archive name for the copy of the data overwritten while appending
+	tailSuffix    = ".tail"
+	tailOffsetLen = 8
+)
+
+// ErrNotAppendable is returned when the archive cannot be appended to
+var ErrNotAppendable = errors.New("archive cannot be appended to")
+
+// appendWriter writes to the file. Data written after held is set is held back, so that the central directory can be
+// completed before it is written
+type appendWriter struct {
+	file *os.File
+	held *bytes.Buffer
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	if w.held != nil {
+		return w.held.Write(p)
+	}
+	return w.file.Write(p)
+}
+
+// NewAppendWriterLevel returns a writer appending to the zip archive in the file, using the specified level. The files
+// of the archive are kept, except for the trailing files with the given names and the hashes, which are overwritten.
+// Kept files are neither read nor rewritten, their central directory records are copied. The overwritten data is kept
+// in a file next to the archive until the writer is closed, so that an interrupted append can be recovered
+func NewAppendWriterLevel(file *os.File, level int, drop []string) (*Writer, error) {
+	if err := restoreTail(file); err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rdr, err := NewReader(file, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	// The files are kept up to the first dropped file. All following files must be dropped
+	var keep []*zip.File
+	var first *zip.File
+	for _, f := range rdr.reader.File {
+		dropped := f.Name == hashesName
+		for _, d := range drop {
+			dropped = dropped || f.Name == d
+		}
+		if first == nil && dropped {
+			first = f
+		} else if first == nil {
+			keep = append(keep, f)
+		} else if !dropped {
+			return nil, ErrNotAppendable
+		}
+	}
+
+	if first == nil {
+		return nil, ErrNotAppendable
+	}
+	offset, err := getHeaderOffset(file, first)
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &appendWriter{file: file}
+	w := NewWriterLevel(aw, level)
+	w.writer.SetOffset(offset)
+	for _, f := range keep {
+		if w.hashes[f.Name], err = getHash(rdr, f); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.tail, err = ioutil.ReadAll(io.NewSectionReader(file, offset, fi.Size()-offset)); err != nil {
+		return nil, err
+	}
+	if w.directory, err = getDirectoryRecords(w.tail, offset, keep); err != nil {
+		return nil, err
+	}
+	w.records = len(keep)
+	if err = writeTail(file, offset, w.tail); err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w.file = file
+	w.offset = offset
+	w.appender = aw
+
+	return w, nil
+}
+
+// RecoverAppend restores the archive in the file if appending to it was interrupted, returning true if it was restored
+func RecoverAppend(fn string) (bool, error) {
+	if _, err := os.Stat(fn + tailSuffix); os.IsNotExist(err) {
+		return false, nil
+	}
+	f, err := os.OpenFile(fn, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	_, err = zip.NewReader(f, fi.Size())
+
+	return err != nil, restoreTail(f)
+}
+
+// getDirectoryRecords returns the central directory records of the kept files, which precede the records of the
+// dropped files. The tail holds the archive data from the offset to the end
+func getDirectoryRecords(tail []byte, offset int64, keep []*zip.File) ([]byte, error) {
+	if len(tail) < directoryEndLen || binary.LittleEndian.Uint32(tail[len(tail)-directoryEndLen:]) != directoryEndSig {
+		return nil, ErrNotAppendable
+	}
+	start := int64(binary.LittleEndian.Uint32(tail[len(tail)-directoryEndLen+16:]))
+	if start == uint32max {
+		// The offset is in the zip64 end record, located by the zip64 locator
+		loc := len(tail) - directoryEndLen - directory64LocLen
+		if loc < 0 || binary.LittleEndian.Uint32(tail[loc:]) != directory64LocSig {
+			return nil, ErrNotAppendable
+		}
+		end := int64(binary.LittleEndian.Uint64(tail[loc+8:])) - offset
+		if end < 0 || end+directory64EndLen > int64(len(tail)) || binary.LittleEndian.Uint32(tail[end:]) != directory64EndSig {
+			return nil, ErrNotAppendable
+		}
+		start = int64(binary.LittleEndian.Uint64(tail[end+48:]))
+	}
+	if start -= offset; start < 0 || start > int64(len(tail)) {
+		return nil, ErrNotAppendable
+	}
+
+	b := tail[start:]
+	pos := 0
+	for _, f := range keep {
+		if pos+directoryHeaderLen > len(b) || binary.LittleEndian.Uint32(b[pos:]) != directoryHeaderSig {
+			return nil, ErrNotAppendable
+		}
+		nameLen := int(binary.LittleEndian.Uint16(b[pos+28:]))
+		n := directoryHeaderLen + nameLen + int(binary.LittleEndian.Uint16(b[pos+30:])) + int(binary.LittleEndian.Uint16(b[pos+32:]))
+		if pos+n > len(b) || string(b[pos+directoryHeaderLen:pos+directoryHeaderLen+nameLen]) != f.Name {
+			return nil, ErrNotAppendable
+		}
+		pos += n
+	}
+
+	return append([]byte(nil), b[:pos]...), nil
+}
+
+// getHeaderOffset returns the offset of the local header of the file
+func getHeaderOffset(r io.ReaderAt, f *zip.File) (int64, error) {
+	dataOffset, err := f.DataOffset()
+	if err != nil {
+		return 0, err
+	}
+	offset := dataOffset - fileHeaderLen - int64(len(f.Name)) - int64(len(f.Extra))
+	var buf [fileHeaderLen]byte
+	if offset < 0 {
+		return 0, ErrNotAppendable
+	} else if _, err = r.ReadAt(buf[:], offset); err != nil {
+		return 0, err
+	} else if binary.LittleEndian.Uint32(buf[:]) != fileHeaderSig || offset+fileHeaderLen+int64(binary.LittleEndian.Uint16(buf[26:]))+int64(binary.LittleEndian.Uint16(buf[28:])) != dataOffset {
+		return 0, ErrNotAppendable
+	}
+
+	return offset, nil
+}
+
+// getHash returns the stored hash of the file, computing it if the archive has no hash for the file
+func getHash(rdr *Reader, f *zip.File) (string, error) {
+	if hash := rdr.GetHash(f.Name); hash != "" {
+		return hash, nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// closeAppend writes the central directory records of the kept and the appended files followed by the end records,
+// then removes the copy of the overwritten data
+func (w *Writer) closeAppend() error {
+	// The central directory written by the zip writer only holds the appended files
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.appender.held = new(bytes.Buffer)
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	held := w.appender.held.Bytes()
+	records, size := w.records, 0
+	for size+directoryHeaderLen <= len(held) && binary.LittleEndian.Uint32(held[size:]) == directoryHeaderSig {
+		size += directoryHeaderLen + int(binary.LittleEndian.Uint16(held[size+28:])) + int(binary.LittleEndian.Uint16(held[size+30:])) + int(binary.LittleEndian.Uint16(held[size+32:]))
+		records++
+	}
+
+	start, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	directory := append(append([]byte(nil), w.directory...), held[:size]...)
+	directory = append(directory, directoryEnd(records, int64(len(directory)), start)...)
+	if _, err = w.file.Write(directory); err != nil {
+		return err
+	} else if err = w.file.Truncate(start + int64(len(directory))); err != nil {
+		return err
+	} else if err = w.file.Sync(); err != nil {
+		return err
+	}
+
+	return w.removeTail()
+}
+
+// directoryRecord returns the central directory record of the file with the local header at the offset
+func directoryRecord(hdr zip.FileHeader, offset int64) []byte {
+	le := binary.LittleEndian
+	extra := stripExtra(hdr.Extra, zip64ExtraID)
+	readerVersion := uint16(zipVersion20)
+	compressedSize, size, headerOffset := uint32(hdr.CompressedSize64), uint32(hdr.UncompressedSize64), uint32(offset)
+	if hdr.CompressedSize64 >= uint32max || hdr.UncompressedSize64 >= uint32max || offset >= uint32max {
+		// The sizes and the offset are in the zip64 extra block
+		var eb [28]byte
+		le.PutUint16(eb[0:], zip64ExtraID)
+		le.PutUint16(eb[2:], 24)
+		le.PutUint64(eb[4:], hdr.UncompressedSize64)
+		le.PutUint64(eb[12:], hdr.CompressedSize64)
+		le.PutUint64(eb[20:], uint64(offset))
+		extra = append(extra, eb[:]...)
+		compressedSize, size = uint32max, uint32max
+		if hdr.CompressedSize64 >= uint32max || hdr.UncompressedSize64 >= uint32max {
+			readerVersion = zipVersion45
+		}
+		if offset >= uint32max {
+			headerOffset = uint32max
+		}
+	}
+
+	var buf [directoryHeaderLen]byte
+	le.PutUint32(buf[0:], directoryHeaderSig)
+	le.PutUint16(buf[4:], hdr.CreatorVersion&0xff00|zipVersion20)
+	le.PutUint16(buf[6:], readerVersion)
+	le.PutUint16(buf[8:], hdr.Flags)
+	le.PutUint16(buf[10:], hdr.Method)
+	le.PutUint16(buf[12:], hdr.ModifiedTime)
+	le.PutUint16(buf[14:], hdr.ModifiedDate)
+	le.PutUint32(buf[16:], hdr.CRC32)
+	le.PutUint32(buf[20:], compressedSize)
+	le.PutUint32(buf[24:], size)
+	le.PutUint16(buf[28:], uint16(len(hdr.Name)))
+	le.PutUint16(buf[30:], uint16(len(extra)))
+	le.PutUint16(buf[32:], uint16(len(hdr.Comment)))
+	le.PutUint32(buf[38:], hdr.ExternalAttrs)
+	le.PutUint32(buf[42:], headerOffset)
+
+	return append(append(append(buf[:], hdr.Name...), extra...), hdr.Comment...)
+}
+
+// directoryEnd returns the end records of the central directory with the number of records, size and offset
+func directoryEnd(records int, size, offset int64) []byte {
+	le := binary.LittleEndian
+	var result []byte
+	r, s, o := uint64(records), uint64(size), uint64(offset)
+	if r >= uint16max || s >= uint32max || o >= uint32max {
+		var buf [directory64EndLen + directory64LocLen]byte
+		le.PutUint32(buf[0:], directory64EndSig)
+		le.PutUint64(buf[4:], directory64EndLen-12)
+		le.PutUint16(buf[12:], zipVersion45)
+		le.PutUint16(buf[14:], zipVersion45)
+		le.PutUint64(buf[24:], r)
+		le.PutUint64(buf[32:], r)
+		le.PutUint64(buf[40:], s)
+		le.PutUint64(buf[48:], o)
+		le.PutUint32(buf[56:], directory64LocSig)
+		le.PutUint64(buf[64:], o+s)
+		le.PutUint32(buf[72:], 1)
+		result = append(result, buf[:]...)
+		r, s, o = uint16max, uint32max, uint32max
+	}
+	var buf [directoryEndLen]byte
+	le.PutUint32(buf[0:], directoryEndSig)
+	le.PutUint16(buf[8:], uint16(r))
+	le.PutUint16(buf[10:], uint16(r))
+	le.PutUint32(buf[12:], uint32(s))
+	le.PutUint32(buf[16:], uint32(o))
+
+	return append(result, buf[:]...)
+}
+
+// Abort restores the trailing files overwritten by an append writer, leaving the archive as it was
+func (w *Writer) Abort() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := writeBack(w.file, w.offset, w.tail); err != nil {
+		return err
+	}
+
+	return w.removeTail()
+}
+
+// removeTail removes the copy of the data overwritten by an append writer. Resumed archives have none
+func (w *Writer) removeTail() error {
+	if w.tail == nil {
+		return nil
+	}
+	return os.Remove(w.file.Name() + tailSuffix)
+}
+
+// writeTail writes the offset and the data from the offset to the end of the archive in the file to a file next to it
+func writeTail(file *os.File, offset int64, tail []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(file.Name()), "."+filepath.Base(file.Name())+".*.tmp")
+	if err != nil {
+		return err
+	}
+	var buf [tailOffsetLen]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(offset))
+	if _, err = f.Write(buf[:]); err == nil {
+		if _, err = f.Write(tail); err == nil {
+			err = f.Sync()
+		}
+	}
+	if er := f.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file.Name()+tailSuffix)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
+
+// restoreTail restores the data overwritten by an interrupted append from the file next to the archive, if any. A
+// readable archive was either not modified yet or completely written, and is kept
+func restoreTail(file *os.File) error {
+	b, err := ioutil.ReadFile(file.Name() + tailSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if len(b) < tailOffsetLen {
+		return ErrNotAppendable
+	}
+	if fi, err := file.Stat(); err != nil {
+		return err
+	} else if _, err = zip.NewReader(file, fi.Size()); err == nil {
+		return os.Remove(file.Name() + tailSuffix)
+	}
+	if err = writeBack(file, int64(binary.LittleEndian.Uint64(b)), b[tailOffsetLen:]); err != nil {
+		return err
+	}
+
+	return os.Remove(file.Name() + tailSuffix)
+}
+
+// writeBack writes the tail to the file at the offset, truncating the file after it
+func writeBack(file *os.File, offset int64, tail []byte) error {
+	if _, err := file.WriteAt(tail, offset); err != nil {
+		return err
+	} else if err = file.Truncate(offset + int64(len(tail))); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
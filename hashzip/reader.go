@@ -17,7 +17,9 @@ type Reader struct {
 
 // File holds information about one file in a zip archive
 type File struct {
-	file               *zip.File
+	file *zip.File
+	// data holds the compressed contents of files found by scanning the local headers
+	data               *io.SectionReader
 	Name               string
 	UncompressedSize64 uint64
 	FileHeader         zip.FileHeader
@@ -97,5 +99,17 @@ func (r *Reader) GetFileByHash(hash string) *File {
 
 // Open opens the file for reading
 func (f *File) Open() (io.ReadCloser, error) {
+	if f.file == nil {
+		raw, _ := f.openRaw()
+		return decompressor(f.FileHeader.Method, raw)
+	}
 	return f.file.Open()
 }
+
+// openRaw returns a reader for the compressed contents of the file
+func (f *File) openRaw() (io.Reader, error) {
+	if f.file == nil {
+		return io.NewSectionReader(f.data, 0, f.data.Size()), nil
+	}
+	return f.file.OpenRaw()
+}
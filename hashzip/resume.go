@@ -0,0 +1,48 @@
+package hashzip
+
+import (
+	"io"
+	"os"
+)
+
+// NewResumeWriterLevel returns a writer continuing the partially written zip archive in the file, using the specified
+// level. The archive has no central directory, so the local headers are scanned for complete files, which are kept
+// and hashed without being rewritten. The scan stops at the first file with one of the given names or the hashes, as
+// the archive was being finalised. Any following data is overwritten
+func NewResumeWriterLevel(file *os.File, level int, drop []string) (*Writer, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &appendWriter{file: file}
+	w := NewWriterLevel(aw, level)
+	var offset int64
+	for {
+		hdr, hash, _, end, ok := scanFile(file, offset, fi.Size())
+		dropped := !ok || hdr.Name == hashesName
+		for _, d := range drop {
+			dropped = dropped || hdr.Name == d
+		}
+		if dropped {
+			break
+		}
+		w.directory = append(w.directory, directoryRecord(hdr, offset)...)
+		w.records++
+		w.hashes[hdr.Name] = hash
+		offset = end
+	}
+
+	if err = file.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w.writer.SetOffset(offset)
+	w.file = file
+	w.offset = offset
+	w.appender = aw
+
+	return w, nil
+}
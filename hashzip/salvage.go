@@ -0,0 +1,171 @@
+package hashzip
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zip"
+)
+
+const (
+	scanBufferSize      = 1 << 20
+	dataDescriptorSig   = 0x08074b50
+	dataDescriptorLen   = 16
+	dataDescriptor64Len = 24
+	uint32max           = 1<<32 - 1
+	flagDataDescriptor  = 0x8
+)
+
+// byteCounter counts the bytes read, implementing io.ByteReader so that the decompressor does not read ahead
+type byteCounter struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (b *byteCounter) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *byteCounter) ReadByte() (byte, error) {
+	c, err := b.r.ReadByte()
+	if err == nil {
+		b.n++
+	}
+	return c, err
+}
+
+// NewSalvageReader returns a reader for the zip archive with the given size, finding the files by scanning the local
+// headers instead of reading the central directory. Damaged files are skipped. The hashes are computed from the contents
+func NewSalvageReader(r io.ReaderAt, size int64) *Reader {
+	var result Reader
+	for offset := int64(0); offset < size; {
+		hdr, hash, dataOffset, end, ok := scanFile(r, offset, size)
+		if !ok {
+			offset = findHeader(r, offset+1, size)
+			continue
+		}
+		if hdr.Name != hashesName {
+			f := &File{Name: hdr.Name, UncompressedSize64: hdr.UncompressedSize64, FileHeader: hdr, Hash: hash, data: io.NewSectionReader(r, dataOffset, int64(hdr.CompressedSize64))}
+			result.File = append(result.File, f)
+		}
+		offset = end
+	}
+
+	return &result
+}
+
+// findHeader returns the offset of the next local header signature at or after the offset, or size if there is none
+func findHeader(r io.ReaderAt, offset, size int64) int64 {
+	var sig [4]byte
+	binary.LittleEndian.PutUint32(sig[:], fileHeaderSig)
+	buf := make([]byte, scanBufferSize)
+	for offset < size {
+		n, _ := r.ReadAt(buf, offset)
+		if n < len(sig) {
+			break
+		}
+		if i := bytes.Index(buf[:n], sig[:]); i != -1 {
+			return offset + int64(i)
+		}
+		offset += int64(n - len(sig) + 1)
+	}
+
+	return size
+}
+
+// scanFile reads the local file at the offset, returning its header, content hash, data offset and end offset. ok is
+// false if there is no complete and intact file at the offset
+func scanFile(r io.ReaderAt, offset, size int64) (hdr zip.FileHeader, hash string, dataOffset, end int64, ok bool) {
+	var buf [fileHeaderLen]byte
+	if _, err := r.ReadAt(buf[:], offset); err != nil || binary.LittleEndian.Uint32(buf[:]) != fileHeaderSig {
+		return
+	}
+	hdr.Flags = binary.LittleEndian.Uint16(buf[6:])
+	hdr.Method = binary.LittleEndian.Uint16(buf[8:])
+	hdr.ModifiedTime = binary.LittleEndian.Uint16(buf[10:])
+	hdr.ModifiedDate = binary.LittleEndian.Uint16(buf[12:])
+	hdr.CRC32 = binary.LittleEndian.Uint32(buf[14:])
+	hdr.CompressedSize64 = uint64(binary.LittleEndian.Uint32(buf[18:]))
+	hdr.UncompressedSize64 = uint64(binary.LittleEndian.Uint32(buf[22:]))
+	nameExtra := make([]byte, int(binary.LittleEndian.Uint16(buf[26:]))+int(binary.LittleEndian.Uint16(buf[28:])))
+	if _, err := r.ReadAt(nameExtra, offset+fileHeaderLen); err != nil {
+		return
+	}
+	hdr.Name = string(nameExtra[:binary.LittleEndian.Uint16(buf[26:])])
+	if extra := nameExtra[len(hdr.Name):]; len(extra) > 0 {
+		hdr.Extra = extra
+	}
+	dataOffset = offset + fileHeaderLen + int64(len(nameExtra))
+
+	h := sha256.New()
+	if strings.HasSuffix(hdr.Name, "/") {
+		return hdr, fmt.Sprintf("%x", h.Sum(nil)), dataOffset, dataOffset, true
+	}
+
+	crc := crc32.NewIEEE()
+	if hdr.Flags&flagDataDescriptor == 0 {
+		// The sizes are known from the local header
+		data, err := decompressor(hdr.Method, io.NewSectionReader(r, dataOffset, int64(hdr.CompressedSize64)))
+		if err != nil {
+			return
+		}
+		if n, err := io.Copy(io.MultiWriter(h, crc), data); err != nil || uint64(n) != hdr.UncompressedSize64 || crc.Sum32() != hdr.CRC32 {
+			return
+		}
+		return hdr, fmt.Sprintf("%x", h.Sum(nil)), dataOffset, dataOffset + int64(hdr.CompressedSize64), true
+	}
+	if hdr.Method != zip.Deflate {
+		return
+	}
+
+	// The sizes are only known from the data descriptor. The compressed size is found by decompressing
+	counter := &byteCounter{r: bufio.NewReader(io.NewSectionReader(r, dataOffset, size-dataOffset))}
+	n, err := io.Copy(io.MultiWriter(h, crc), flate.NewReader(counter))
+	if err != nil {
+		return
+	}
+	hdr.CompressedSize64 = uint64(counter.n)
+	hdr.UncompressedSize64 = uint64(n)
+	hdr.CRC32 = crc.Sum32()
+
+	descriptor := make([]byte, dataDescriptorLen)
+	if hdr.CompressedSize64 >= uint32max || hdr.UncompressedSize64 >= uint32max {
+		descriptor = make([]byte, dataDescriptor64Len)
+	}
+	descriptorOffset := dataOffset + counter.n
+	if _, err = r.ReadAt(descriptor, descriptorOffset); err != nil {
+		return
+	}
+	if binary.LittleEndian.Uint32(descriptor) != dataDescriptorSig || binary.LittleEndian.Uint32(descriptor[4:]) != hdr.CRC32 {
+		return
+	}
+	if len(descriptor) == dataDescriptorLen && (uint64(binary.LittleEndian.Uint32(descriptor[8:])) != hdr.CompressedSize64 || uint64(binary.LittleEndian.Uint32(descriptor[12:])) != hdr.UncompressedSize64) {
+		return
+	} else if len(descriptor) == dataDescriptor64Len && (binary.LittleEndian.Uint64(descriptor[8:]) != hdr.CompressedSize64 || binary.LittleEndian.Uint64(descriptor[16:]) != hdr.UncompressedSize64) {
+		return
+	}
+
+	return hdr, fmt.Sprintf("%x", h.Sum(nil)), dataOffset, descriptorOffset + int64(len(descriptor)), true
+}
+
+// decompressor returns a reader decompressing the data compressed with the method
+func decompressor(method uint16, data io.Reader) (io.ReadCloser, error) {
+	switch method {
+	case zip.Store:
+		return ioutil.NopCloser(data), nil
+	case zip.Deflate:
+		return flate.NewReader(data), nil
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+}
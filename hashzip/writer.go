@@ -3,17 +3,22 @@ package hashzip
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"os"
+	"time"
 
 	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/zip"
 )
 
+// extTimeExtraID is the id of the extended timestamp extra block
+const extTimeExtraID = 0x5455
+
 // Writer holds the data for writing to a zip archive, ignoring duplicate file names
 type Writer struct {
 	io.Writer
@@ -22,6 +27,17 @@ type Writer struct {
 	h       hash.Hash
 	hashes  map[string]string
 	current string
+	entry   io.Writer
+	// file, offset and tail are set when appending, holding the archive file and the original trailing data. directory
+	// holds the central directory records of the kept files
+	file      *os.File
+	offset    int64
+	tail      []byte
+	directory []byte
+	records   int
+	appender  *appendWriter
+	// modified is the modification time of all files, if set
+	modified time.Time
 }
 
 // NewWriter returns a new writer
@@ -44,6 +60,16 @@ func (w *Writer) Exists(name string) bool {
 	return w.hashes[name] != ""
 }
 
+// GetHash returns the hash of the given file in the archive, or an empty string if the file does not exist
+func (w *Writer) GetHash(name string) string {
+	return w.hashes[name]
+}
+
+// SetModified sets the modification time of all files subsequently written or copied
+func (w *Writer) SetModified(t time.Time) {
+	w.modified = t
+}
+
 // Create creates a new entry and returns a writer
 func (w *Writer) Create(name string) (io.Writer, error) {
 	return w.CreateHeader(&zip.FileHeader{Name: name})
@@ -54,6 +80,9 @@ func (w *Writer) CreateHeader(fh *zip.FileHeader) (io.Writer, error) {
 	w.end()
 	copy := *fh
 	copy.Method = zip.Deflate
+	if copy.Modified.IsZero() {
+		copy.Modified = w.modified
+	}
 	if w.hashes[copy.Name] != "" {
 		return nil, errors.New("file exists")
 	}
@@ -63,6 +92,7 @@ func (w *Writer) CreateHeader(fh *zip.FileHeader) (io.Writer, error) {
 	}
 	w.h = sha256.New()
 	if writer, err := w.writer.CreateHeader(&copy); err == nil {
+		w.entry = writer
 		return io.MultiWriter(writer, w.h), err
 	} else {
 		return nil, err
@@ -76,13 +106,29 @@ func (w *Writer) end() {
 	}
 }
 
+// Flush completes the current entry and flushes all written data to the underlying writer
+func (w *Writer) Flush() error {
+	w.end()
+	if closer, ok := w.entry.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	w.entry = nil
+	return w.writer.Flush()
+}
+
 // Close closes the zip writer
 func (w *Writer) Close() error {
 	w.end()
-	if wr, err := w.writer.CreateHeader(&zip.FileHeader{Name: ".hashes", Method: zip.Deflate}); err == nil {
+	if wr, err := w.writer.CreateHeader(&zip.FileHeader{Name: ".hashes", Method: zip.Deflate, Modified: w.modified}); err == nil {
+		w.entry = wr
 		data, _ := json.Marshal(w.hashes)
 		io.Copy(wr, bytes.NewReader(data))
 	}
+	if w.file != nil {
+		return w.closeAppend()
+	}
 	return w.writer.Close()
 }
 
@@ -92,9 +138,40 @@ func (w *Writer) Copy(name string, zf *File) error {
 	if w.verbose {
 		fmt.Printf("Copying '%s'\n", name)
 	}
-	err := w.writer.Copy(name, zf.file)
-	if err == nil {
+	hdr := zf.FileHeader
+	if name != "" {
+		hdr.Name = name
+	}
+	// The extended timestamp is added from the modification time
+	hdr.Extra = stripExtra(hdr.Extra, extTimeExtraID)
+	if !w.modified.IsZero() {
+		hdr.Modified = w.modified
+	}
+	raw, err := zf.openRaw()
+	if err != nil {
+		return err
+	}
+	if w.entry, err = w.writer.CreateHeaderRaw(&hdr); err != nil {
+		return err
+	}
+	if _, err = io.Copy(w.entry, raw); err == nil {
 		w.hashes[name] = zf.Hash
 	}
 	return err
 }
+
+// stripExtra returns the extra field without the blocks with the id
+func stripExtra(extra []byte, id uint16) (result []byte) {
+	for len(extra) >= 4 {
+		size := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra) {
+			break
+		}
+		if binary.LittleEndian.Uint16(extra) != id {
+			result = append(result, extra[:size]...)
+		}
+		extra = extra[size:]
+	}
+
+	return append(result, extra...)
+}
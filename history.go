@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/imagesource"
+)
+
+// getHistory returns a copy of the history with an entry for the operation changing the old manifests to the new
+// manifests appended. The user and host are omitted from reproducible archives
+func getHistory(history []diz.HistoryEntry, operation string, old, newManifests []diz.Manifest) []diz.HistoryEntry {
+	entry := diz.NewHistoryEntry(operation, old, newManifests)
+	if *reproducible {
+		entry.Time = sourceDateEpoch
+	} else {
+		entry.Time = time.Now().UTC()
+		if u, err := user.Current(); err == nil {
+			entry.User = u.Username
+		} else {
+			entry.User = os.Getenv("USER")
+		}
+		entry.Host, _ = os.Hostname()
+	}
+
+	return append(append([]diz.HistoryEntry(nil), history...), entry)
+}
+
+// getSourceHistory returns the history of zip archive sources, nil for other sources
+func getSourceHistory(s imagesource.ImageSource) ([]diz.HistoryEntry, error) {
+	if z, ok := s.(*imagesource.ZipImageSource); ok {
+		return z.GetHistory()
+	}
+	return nil, nil
+}
+
+// history prints the history of the archive, optionally only the changes of the tag
+func history(fn string, tags []string) error {
+	z, err := imagesource.NewZipImageSource(fn)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	h, err := z.GetHistory()
+	if err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		h = diz.FilterHistory(h, tags[0])
+	}
+	return printOutput(h, h, func() error { return printHistory(h) })
+}
+
+func printHistory(history []diz.HistoryEntry) error {
+	for _, h := range history {
+		by := h.User
+		if h.Host != "" {
+			by += "@" + h.Host
+		}
+		fmt.Printf("%s  %s  %s\n", h.Time.Format("2006-01-02 15:04:05"), h.Operation, by)
+		for _, c := range h.Added {
+			fmt.Printf("  + %s %s\n", c.Tag, shortID(c.NewConfig))
+		}
+		for _, c := range h.Removed {
+			fmt.Printf("  - %s %s\n", c.Tag, shortID(c.OldConfig))
+		}
+		for _, c := range h.Changed {
+			fmt.Printf("  ~ %s %s -> %s\n", c.Tag, shortID(c.OldConfig), shortID(c.NewConfig))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package imagesource
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRegistry(t *testing.T) {
+	for registry, expected := range map[string]string{
+		"https://index.docker.io/v1/":         "docker.io",
+		"docker.io":                           "docker.io",
+		"registry-1.docker.io":                "docker.io",
+		"":                                    "docker.io",
+		"https://gcr.io":                      "gcr.io",
+		"123.dkr.ecr.eu-west-1.amazonaws.com": "123.dkr.ecr.eu-west-1.amazonaws.com",
+		"localhost:5000/v2/":                  "localhost:5000",
+	} {
+		assert.Equal(t, expected, normalizeRegistry(registry), registry)
+	}
+}
+
+func TestCredentialHelpers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script credential helper")
+	}
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	script := `#!/bin/sh
+read url
+echo "$url" >> "$0.log"
+case "$url" in
+  https://index.docker.io/v1/) echo '{"ServerURL":"'$url'","Username":"hub","Secret":"hubsecret"}' ;;
+  gcr.io) echo '{"ServerURL":"'$url'","Username":"<token>","Secret":"refresh"}' ;;
+  *) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(script), 0755))
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	defer func(c map[string]authEntry, h map[string]string, s string, r map[string]helperResult) {
+		cache, credHelpers, credsStore, helperCache = c, h, s, r
+	}(cache, credHelpers, credsStore, helperCache)
+	helperCache = make(map[string]helperResult, 0)
+	cache = map[string]authEntry{"quay.io": {Auth: base64.StdEncoding.EncodeToString([]byte("user:pass"))}}
+	credHelpers = map[string]string{"gcr.io": "test"}
+	credsStore = ""
+
+	// credHelpers take precedence, auths are used otherwise
+	username, password, token := getUsernamePassword("gcr.io")
+	assert.Equal(t, []string{"", "", "refresh"}, []string{username, password, token})
+	username, password, token = getUsernamePassword("quay.io")
+	assert.Equal(t, []string{"user", "pass", ""}, []string{username, password, token})
+	assert.Equal(t, "", getConfigCredentials("docker.io"))
+
+	credsStore = "test"
+	username, password, token = getUsernamePassword("docker.io")
+	assert.Equal(t, []string{"hub", "hubsecret", ""}, []string{username, password, token})
+	username, password, token = getUsernamePassword("quay.io")
+	assert.Equal(t, []string{"user", "pass", ""}, []string{username, password, token})
+
+	// The helper runs once per server URL
+	username, password, token = getUsernamePassword("docker.io")
+	assert.Equal(t, []string{"hub", "hubsecret", ""}, []string{username, password, token})
+	getUsernamePassword("gcr.io")
+	log, err := ioutil.ReadFile(filepath.Join(dir, "docker-credential-test.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, "gcr.io\nhttps://index.docker.io/v1/\nquay.io\n", string(log))
+}
@@ -1,46 +1,155 @@
 package imagesource
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"strings"
+	"sync"
 )
 
+const (
+	credentialHelperPrefix = "docker-credential-"
+	dockerHubServerURL     = "https://index.docker.io/v1/"
+	identityTokenUsername  = "<token>"
+)
+
+type authEntry struct {
+	Auth          string `json:"auth"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+type dockerConfig struct {
+	Auths       map[string]authEntry `json:"auths"`
+	CredsStore  string               `json:"credsStore"`
+	CredHelpers map[string]string    `json:"credHelpers"`
+}
+
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// helperResult holds the outcome of running a credential helper
+type helperResult struct {
+	credentials helperCredentials
+	err         error
+}
+
 func init() {
 	for _, p := range []string{"$DOCKER_CONFIG/config.json", "$HOME/.docker/config.json", "$USERPROFILE/.docker/config.json"} {
 		if b, e := ioutil.ReadFile(os.ExpandEnv(p)); e == nil {
-			data := make(map[string]interface{}, 0)
+			var data dockerConfig
 			if err := json.Unmarshal(b, &data); err == nil {
-				if auths, ok := data["auths"]; ok {
-					if authsmap, ok := auths.(map[string]interface{}); ok {
-						for k, iv := range authsmap {
-							if v, ok := iv.(map[string]interface{}); ok {
-								if auth, ok := v["auth"]; ok {
-									if s, ok := auth.(string); ok {
-										cache[k] = s
-									}
-								}
-							}
-						}
-					}
+				for k, v := range data.Auths {
+					cache[normalizeRegistry(k)] = v
+				}
+				for k, v := range data.CredHelpers {
+					credHelpers[normalizeRegistry(k)] = v
+				}
+				if credsStore == "" {
+					credsStore = data.CredsStore
 				}
 			}
 		}
 	}
 }
 
-var cache = make(map[string]string, 0)
+var (
+	cache       = make(map[string]authEntry, 0)
+	credHelpers = make(map[string]string, 0)
+	credsStore  string
+	// helperCache holds the credential helper results by helper and server URL for the life of the process
+	helperCache = make(map[string]helperResult, 0)
+	helperMutex sync.Mutex
+)
+
+// normalizeRegistry normalizes the registry key, so that e.g. "https://index.docker.io/v1/" and "docker.io" are equal
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(registry)
+	for _, prefix := range []string{"https://", "http://"} {
+		registry = strings.TrimPrefix(registry, prefix)
+	}
+	registry = strings.SplitN(registry, "/", 2)[0]
+	switch registry {
+	case "", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubRegistry
+	}
+	return registry
+}
+
+// getServerURL returns the server URL used for looking up credentials of the normalized registry
+func getServerURL(registry string) string {
+	if registry == dockerHubRegistry {
+		return dockerHubServerURL
+	}
+	return registry
+}
 
 func getConfigCredentials(repository string) string {
-	if a, ok := cache[repository]; ok {
-		if dec, err := base64.StdEncoding.DecodeString(a); err == nil {
-			if split := strings.Split(string(dec), ":"); len(split) == 2 {
+	registry := normalizeRegistry(repository)
+	helper, ok := credHelpers[registry]
+	if !ok {
+		helper = credsStore
+	}
+	if helper != "" {
+		if c, err := getCachedHelperCredentials(helper, getServerURL(registry)); err == nil && c.Secret != "" {
+			if c.Username == identityTokenUsername {
+				return marshalIdentityToken(c.Secret)
+			}
+			return marshalCredentials(c.Username, c.Secret)
+		} else if err != nil {
+			fmt.Printf("Credential helper '%s' failed for %s: %v\n", helper, registry, err)
+		}
+	}
+
+	if a, ok := cache[registry]; ok {
+		if a.IdentityToken != "" {
+			return marshalIdentityToken(a.IdentityToken)
+		}
+		if dec, err := base64.StdEncoding.DecodeString(a.Auth); err == nil {
+			if split := strings.SplitN(string(dec), ":", 2); len(split) == 2 {
 				return marshalCredentials(split[0], split[1])
 			}
 		}
-		return a
+		return a.Auth
 	}
 	return ""
 }
+
+// getCachedHelperCredentials gets the credentials for the server URL, running the credential helper once per process
+func getCachedHelperCredentials(helper, serverURL string) (helperCredentials, error) {
+	helperMutex.Lock()
+	defer helperMutex.Unlock()
+	key := helper + " " + serverURL
+	r, ok := helperCache[key]
+	if !ok {
+		r.credentials, r.err = getHelperCredentials(helper, serverURL)
+		helperCache[key] = r
+	}
+	return r.credentials, r.err
+}
+
+// getHelperCredentials gets the credentials for the server URL using the docker-credential-helpers protocol
+func getHelperCredentials(helper, serverURL string) (result helperCredentials, err error) {
+	cmd := exec.Command(credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stdout.String() + stderr.String()); strings.Contains(msg, "credentials not found") {
+			err = nil
+		} else if msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+		return
+	}
+	err = json.Unmarshal(stdout.Bytes(), &result)
+	return
+}
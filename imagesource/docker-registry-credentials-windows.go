@@ -11,9 +11,13 @@ var (
 )
 
 func getCredentials(repository string) string {
-	if u, p, e := cred.Get(repository); e == nil {
+	if c := getConfigCredentials(repository); c != "" {
+		return c
+	} else if u, p, e := cred.Get(getServerURL(normalizeRegistry(repository))); e == nil {
+		if u == identityTokenUsername {
+			return marshalIdentityToken(p)
+		}
 		return marshalCredentials(u, p)
-	} else {
-		return getConfigCredentials(repository)
 	}
+	return ""
 }
@@ -13,3 +13,23 @@ func marshalCredentials(username, password string) string {
 
 	return base64.StdEncoding.EncodeToString(jsonBytes)
 }
+
+func marshalIdentityToken(token string) string {
+	jsonBytes, _ := json.Marshal(map[string]string{
+		"identitytoken": token,
+	})
+
+	return base64.StdEncoding.EncodeToString(jsonBytes)
+}
+
+// getUsernamePassword returns the username and password, or the identity token, for the registry, if any
+func getUsernamePassword(registry string) (username, password, identityToken string) {
+	if b, err := base64.StdEncoding.DecodeString(getCredentials(registry)); err == nil {
+		credentials := make(map[string]string, 0)
+		if err = json.Unmarshal(b, &credentials); err == nil {
+			username, password, identityToken = credentials["username"], credentials["password"], credentials["identitytoken"]
+		}
+	}
+
+	return
+}
@@ -0,0 +1,79 @@
+package imagesource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// NewDockerImageSink returns an image sink loading the images into the Docker daemon. Closing the sink verifies that every tag was loaded
+func NewDockerImageSink(cli *client.Client) ImageSink {
+	pr, pw := io.Pipe()
+	s := &dockerImageSink{tarImageSink: newTarImageSink(pw), cli: cli, done: make(chan error, 1)}
+	go func() {
+		err := s.load(pr)
+		pr.CloseWithError(err)
+		s.done <- err
+	}()
+	return s
+}
+
+type dockerImageSink struct {
+	*tarImageSink
+	cli  *client.Client
+	done chan error
+}
+
+func (s *dockerImageSink) load(rdr io.Reader) error {
+	response, err := s.cli.ImageLoad(context.Background(), rdr, true)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if !response.JSON {
+		_, err = io.Copy(ioutil.Discard, response.Body)
+		return err
+	}
+
+	return decodeJSONMessages("load", response.Body, func(m jsonmessage.JSONMessage) {
+		if stream := strings.TrimSpace(m.Stream); stream != "" {
+			fmt.Println(stream)
+		}
+	})
+}
+
+func (s *dockerImageSink) Close() error {
+	err := s.tarImageSink.Close()
+	if er := <-s.done; er != nil {
+		err = er
+	}
+	if err == nil {
+		err = s.verify()
+	}
+	return err
+}
+
+// verify checks that every tag of the loaded manifests refers to the image ID from the manifest config
+func (s *dockerImageSink) verify() error {
+	var failed []string
+	for _, m := range s.manifests {
+		id := "sha256:" + diz.GetConfig(m)
+		for _, tag := range m.RepoTags {
+			if inspect, _, err := s.cli.ImageInspectWithRaw(context.Background(), tag); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", tag, err))
+			} else if inspect.ID != id {
+				failed = append(failed, fmt.Sprintf("%s: image ID is %s, expected %s", tag, inspect.ID, id))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("image verification failed:\n  %s", strings.Join(failed, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package imagesource
+
+import (
+	"archive/tar"
+	"io"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+)
+
+// NewTarImageSink returns an image sink writing a docker-archive tar (as created by 'docker save') to the writer, which is closed when the sink is closed
+func NewTarImageSink(w io.WriteCloser) ImageSink {
+	return newTarImageSink(w)
+}
+
+func newTarImageSink(w io.WriteCloser) *tarImageSink {
+	return &tarImageSink{closer: w, writer: tar.NewWriter(w), written: make(map[string]bool, 0)}
+}
+
+type tarImageSink struct {
+	closer    io.Closer
+	writer    *tar.Writer
+	written   map[string]bool
+	manifests []diz.Manifest
+}
+
+func (s *tarImageSink) Exists(name string) bool {
+	return s.written[name]
+}
+
+func (s *tarImageSink) Write(name string, size int64, rdr io.Reader) (err error) {
+	hdr := &tar.Header{Name: name, Size: size, Typeflag: tar.TypeReg, Mode: 0644}
+	if strings.HasSuffix(name, "/") {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Mode = 0755
+		hdr.Size = 0
+	}
+	if err = s.writer.WriteHeader(hdr); err != nil {
+		return
+	}
+	if hdr.Size > 0 {
+		if _, err = io.CopyN(s.writer, rdr, hdr.Size); err != nil {
+			return
+		}
+	}
+	s.written[name] = true
+
+	return
+}
+
+func (s *tarImageSink) WriteManifests(manifests []diz.Manifest) error {
+	s.manifests = diz.MergeManifests(s.manifests, manifests)
+	return nil
+}
+
+func (s *tarImageSink) Close() error {
+	err := diz.WriteTarManifests(s.writer, s.manifests)
+	if er := s.writer.Close(); err == nil {
+		err = er
+	}
+	if er := s.closer.Close(); err == nil {
+		err = er
+	}
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package imagesource
+
+import (
+	"io"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/hashzip"
+)
+
+// NewZipImageSink returns an image sink writing a diz zip archive with the metadata and, if not nil, the history to the
+// writer, which is closed when the sink is closed
+func NewZipImageSink(w io.WriteCloser, level int, meta *diz.Meta, history []diz.HistoryEntry) ImageSink {
+	return &zipImageSink{closer: w, writer: hashzip.NewWriterLevel(w, level), meta: meta, history: history}
+}
+
+type zipImageSink struct {
+	closer    io.Closer
+	writer    *hashzip.Writer
+	manifests []diz.Manifest
+	meta      *diz.Meta
+	history   []diz.HistoryEntry
+}
+
+func (s *zipImageSink) Exists(name string) bool {
+	return s.writer.Exists(diz.EntryName(name))
+}
+
+func (s *zipImageSink) Write(name string, size int64, rdr io.Reader) error {
+	return diz.WriteEntry(s.writer, name, rdr)
+}
+
+func (s *zipImageSink) WriteManifests(manifests []diz.Manifest) error {
+	s.manifests = diz.MergeManifests(s.manifests, manifests)
+	return nil
+}
+
+func (s *zipImageSink) Close() error {
+	err := diz.WriteManifests(s.manifests, s.writer)
+	if err == nil {
+		err = diz.WriteMeta(s.meta, s.writer)
+	}
+	if err == nil && s.history != nil {
+		err = diz.WriteHistory(s.history, s.writer)
+	}
+	if er := s.writer.Close(); err == nil {
+		err = er
+	}
+	if er := s.closer.Close(); err == nil {
+		err = er
+	}
+	return err
+}
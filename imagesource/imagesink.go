@@ -0,0 +1,51 @@
+package imagesource
+
+import (
+	"io"
+
+	"github.com/JohanLindvall/diz/diz"
+)
+
+// ImageSink defines an interface for writing Docker images to a destination
+type ImageSink interface {
+	// Exists returns true if the image file (a config or a file in a layer directory) was already written to the sink.
+	// Files present in the destination before the sink was opened are not reported, as 'docker load' needs every file
+	Exists(name string) bool
+	// Write writes the image file with the given size to the sink. Directory names end with '/'
+	Write(name string, size int64, rdr io.Reader) error
+	// WriteManifests adds the manifests to the sink. The manifests are written when the sink is closed
+	WriteManifests(manifests []diz.Manifest) error
+	Close() error
+}
+
+// Copy copies the images with the given tags from the source to the sink, skipping image files already held by the sink
+func Copy(source ImageSource, sink ImageSink, tags []string) error {
+	if z, ok := source.(*ZipImageSource); ok {
+		if zs, ok := sink.(*zipImageSink); ok {
+			// Copy the compressed contents without recompressing
+			if m, err := z.CopyToZip(zs.writer, tags); err != nil {
+				return err
+			} else {
+				return zs.WriteManifests(m)
+			}
+		}
+	}
+
+	rdr, err := source.ReadTar(tags)
+	if err != nil {
+		return err
+	}
+	defer rdr.Close()
+
+	m, err := diz.ReadTar(rdr, func(name string, size int64, rdr io.Reader) error {
+		if sink.Exists(name) {
+			return nil
+		}
+		return sink.Write(name, size, rdr)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sink.WriteManifests(m)
+}
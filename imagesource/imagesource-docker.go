@@ -3,32 +3,30 @@ package imagesource
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
+	"strings"
 
 	"github.com/JohanLindvall/diz/diz"
-	"github.com/JohanLindvall/diz/dockerref"
 	"github.com/JohanLindvall/diz/hashzip"
-	"github.com/JohanLindvall/diz/str"
-	"github.com/JohanLindvall/diz/util"
 	"github.com/docker/distribution/context"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 )
 
 // NewDockerImageSource returns a Docker image source
-func NewDockerImageSource(cli *client.Client, pull bool) (source ImageSource) {
-	source = &dockerImageSource{cli: cli, pull: pull}
+func NewDockerImageSource(cli *client.Client, pull bool, options PullOptions) (source ImageSource) {
+	source = &dockerImageSource{cli: cli, pull: pull, options: options}
 	return
 }
 
 type dockerImageSource struct {
-	cli  *client.Client
-	pull bool
+	cli     *client.Client
+	pull    bool
+	options PullOptions
 }
 
 func (s *dockerImageSource) GlobTags(globTags []string) (result []string, err error) {
 	if s.pull {
-		result = globTags
+		result, err = newRegistryClient(s.options.RetryOptions).GlobTags(globTags)
 		return
 	}
 	result, err = s.globTags(globTags)
@@ -65,32 +63,35 @@ func (s *dockerImageSource) CopyToZip(writer *hashzip.Writer, tags []string) (m
 	return
 }
 
-func (s *dockerImageSource) ReadTar(tags []string) (io.ReadCloser, error) {
-	if err := s.pullIfNeeded(tags); err != nil {
-		return nil, err
+func (s *dockerImageSource) GetManifests(tags []string) (result []diz.Manifest, err error) {
+	if err = s.pullIfNeeded(tags); err != nil {
+		return
 	}
-	fmt.Printf("Saving %d images\n", len(tags))
-	return s.cli.ImageSave(context.Background(), tags)
-}
-
-func (s *dockerImageSource) pullIfNeeded(tags []string) error {
-	if s.pull {
-		existing, err := s.globTags(tags)
-		if err != nil {
-			return err
+	for _, tag := range tags {
+		var inspect types.ImageInspect
+		if inspect, _, err = s.cli.ImageInspectWithRaw(context.Background(), tag); err != nil {
+			return
 		}
-		for _, tag := range str.RemoveSlice(tags, existing) {
-			normalized := dockerref.NormalizeReference(tag)
-			fmt.Printf("Pulling '%s'\n", normalized)
-			reader, err := s.cli.ImagePull(context.Background(), normalized, types.ImagePullOptions{RegistryAuth: getCredentials(dockerref.GetRegistry(normalized))})
-			if err != nil {
-				return err
-			}
-			if _, err = util.CopyAndClose(ioutil.Discard, reader); err != nil {
-				return err
+		config := strings.TrimPrefix(inspect.ID, "sha256:") + ".json"
+		found := false
+		for i := range result {
+			if result[i].Config == config {
+				result[i].RepoTags = append(result[i].RepoTags, tag)
+				found = true
 			}
 		}
+		if !found {
+			result = append(result, diz.Manifest{Config: config, RepoTags: []string{tag}})
+		}
 	}
 
-	return nil
+	return
+}
+
+func (s *dockerImageSource) ReadTar(tags []string) (io.ReadCloser, error) {
+	if err := s.pullIfNeeded(tags); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Saving %d images\n", len(tags))
+	return s.cli.ImageSave(context.Background(), tags)
 }
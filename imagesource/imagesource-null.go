@@ -28,6 +28,10 @@ func (s *nullImageSource) CopyToZip(writer *hashzip.Writer, tags []string) (m []
 	return
 }
 
+func (s *nullImageSource) GetManifests(tags []string) (m []diz.Manifest, err error) {
+	return
+}
+
 func (s *nullImageSource) ReadTar(tags []string) (rdr io.ReadCloser, err error) {
 	rdr = s
 	return
@@ -0,0 +1,86 @@
+package imagesource
+
+import (
+	"io"
+	"os"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/hashzip"
+)
+
+// NewTarImageSource returns an image source reading a docker-archive tar (as created by 'docker save')
+func NewTarImageSource(fn string) (source ImageSource, err error) {
+	var t tarImageSource
+	if t.file, err = os.Open(fn); err != nil {
+		return
+	}
+	if t.manifests, err = diz.ReadTar(t.file, func(name string, size int64, rdr io.Reader) error { return nil }); err != nil {
+		t.file.Close()
+		return
+	}
+	source = &t
+
+	return
+}
+
+type tarImageSource struct {
+	file      *os.File
+	manifests []diz.Manifest
+}
+
+func (t *tarImageSource) GlobTags(tags []string) (result []string, err error) {
+	for _, m := range diz.FilterManifests(t.manifests, tags) {
+		result = append(result, m.RepoTags...)
+	}
+
+	return
+}
+
+func (t *tarImageSource) Close() error {
+	return t.file.Close()
+}
+
+func (t *tarImageSource) CopyToZip(writer *hashzip.Writer, tags []string) (m []diz.Manifest, err error) {
+	var rdr io.ReadCloser
+	if rdr, err = t.ReadTar(tags); err != nil {
+		return
+	}
+	defer rdr.Close()
+
+	m, err = diz.CopyFromTar(rdr, writer)
+
+	return
+}
+
+func (t *tarImageSource) GetManifests(tags []string) ([]diz.Manifest, error) {
+	return diz.FilterManifests(t.manifests, tags), nil
+}
+
+func (t *tarImageSource) ReadTar(tags []string) (io.ReadCloser, error) {
+	// Open the file again, allowing concurrent readers
+	file, err := os.Open(t.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	m := diz.FilterManifests(t.manifests, tags)
+	references := diz.References(m)
+	pr, pw := io.Pipe()
+	go func() {
+		sink := newTarImageSink(nopCloser{pw})
+		defer file.Close()
+		_, err := diz.ReadTar(file, func(name string, size int64, rdr io.Reader) error {
+			if diz.IsReferenced(references, name) {
+				return sink.Write(name, size, rdr)
+			}
+			return nil
+		})
+		if err == nil {
+			err = sink.WriteManifests(m)
+		}
+		if er := sink.Close(); err == nil {
+			err = er
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
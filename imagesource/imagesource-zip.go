@@ -55,6 +55,50 @@ func (z *ZipImageSource) CopyToZip(writer *hashzip.Writer, tags []string) (m []d
 	return
 }
 
+// CopyManifestsToZip copies the contents of the images with the given manifests to the zip archive, but does not write the manifests
+func (z *ZipImageSource) CopyManifestsToZip(writer *hashzip.Writer, manifests []diz.Manifest) error {
+	return z.archive.CopyToZip(writer, manifests)
+}
+
+// GetDifferingFiles returns the names of the image files, selected by the manifests, already written to the zip archive with different contents
+func (z *ZipImageSource) GetDifferingFiles(writer *hashzip.Writer, manifests []diz.Manifest) []string {
+	return z.archive.GetDifferingFiles(writer, manifests)
+}
+
+// GetInfo returns the size accounting and config details of the images in the archive
+func (z *ZipImageSource) GetInfo() (diz.ArchiveInfo, error) {
+	return z.archive.GetInfo()
+}
+
+// GetLayerTags returns the tags of the images referencing the layer given by a prefix of its layer directory or content hash
+func (z *ZipImageSource) GetLayerTags(layer string) []string {
+	return z.archive.GetLayerTags(layer)
+}
+
+// Diff returns the differences between this archive and the new archive
+func (z *ZipImageSource) Diff(newSource *ZipImageSource) diz.Diff {
+	return diz.DiffArchives(z.archive, newSource.archive)
+}
+
+// UnreferencedSize returns the number of compressed bytes of the image files not referenced by the manifests
+func (z *ZipImageSource) UnreferencedSize(manifests []diz.Manifest) int64 {
+	return z.archive.UnreferencedSize(manifests)
+}
+
+// CopyFromSource copies the images with the given tags from the source to the zip archive, but does not write the manifests. Image files present in this archive are copied without recompressing
+func (z *ZipImageSource) CopyFromSource(writer *hashzip.Writer, s ImageSource, tags []string) ([]diz.Manifest, error) {
+	if _, ok := s.(*ZipImageSource); ok {
+		return s.CopyToZip(writer, tags)
+	}
+	rdr, err := s.ReadTar(tags)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	return z.archive.CopyFromTar(rdr, writer)
+}
+
 func (z *ZipImageSource) ReadTar(tags []string) (io.ReadCloser, error) {
 	pr, pw := io.Pipe()
 	go func() {
@@ -63,6 +107,18 @@ func (z *ZipImageSource) ReadTar(tags []string) (io.ReadCloser, error) {
 	return pr, nil
 }
 
+func (z *ZipImageSource) GetManifests(tags []string) ([]diz.Manifest, error) {
+	return diz.FilterManifests(z.archive.Manifests, tags), nil
+}
+
+func (z *ZipImageSource) GetImageConfig(m diz.Manifest) (diz.ImageConfig, error) {
+	return z.archive.GetImageConfig(m)
+}
+
+func (z *ZipImageSource) GetUncompressedSize(name string) int64 {
+	return z.archive.GetUncompressedSize(name)
+}
+
 func (z *ZipImageSource) GetRegistryManifest(repoTag string) (diz.RegistryManifest, error) {
 	return z.archive.GetRegistryManifest(repoTag)
 }
@@ -71,6 +127,16 @@ func (z *ZipImageSource) WriteFileByHash(writer io.Writer, layer string) error {
 	return z.archive.WriteFileByHash(writer, layer)
 }
 
+// GetHistory returns the history of the archive
+func (z *ZipImageSource) GetHistory() ([]diz.HistoryEntry, error) {
+	return z.archive.GetHistory()
+}
+
+// Meta returns the metadata of the archive, nil for archives written before it was introduced
+func (z *ZipImageSource) Meta() *diz.Meta {
+	return z.archive.Meta
+}
+
 func (z *ZipImageSource) Manifests() []diz.Manifest {
 	return z.archive.Manifests
 }
@@ -79,10 +145,10 @@ func (z *ZipImageSource) Read(path string) (io.ReadCloser, error) {
 	return z.archive.Read(path)
 }
 
+// GetDigestToTags returns the tags, including the hidden tags of previous images, of every registry manifest digest
 func (z *ZipImageSource) GetDigestToTags() (result map[string][]string, err error) {
 	result = make(map[string][]string)
-	tags, _ := z.GlobTags([]string{"*"})
-	for _, tag := range tags {
+	for _, tag := range diz.GetRepoTags(z.archive.Manifests) {
 		var repoManifest diz.RegistryManifest
 		if repoManifest, err = z.GetRegistryManifest(tag); err != nil {
 			break
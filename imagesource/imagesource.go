@@ -15,4 +15,6 @@ type ImageSource interface {
 	CopyToZip(writer *hashzip.Writer, tags []string) ([]diz.Manifest, error)
 	// ReadTar returns an io.Reader with a tar archive of the contents
 	ReadTar(tags []string) (io.ReadCloser, error)
+	// GetManifests returns the manifests of the images with the given tags. Layers are not set for Docker daemon sources
+	GetManifests(tags []string) ([]diz.Manifest, error)
 }
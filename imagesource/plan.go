@@ -0,0 +1,121 @@
+package imagesource
+
+import (
+	"context"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/str"
+	"github.com/docker/docker/api/types"
+)
+
+// Plan describes the images and layers an archive would be created from
+type Plan struct {
+	Tags           []string    `json:"tags"`
+	CopiedTags     []string    `json:"copiedTags"`
+	PulledTags     []string    `json:"pulledTags"`
+	NewLayers      []diz.Layer `json:"newLayers"`
+	ExistingLayers []diz.Layer `json:"existingLayers"`
+	// EstimatedSize is the estimated number of bytes of the archive. Layers read from the Docker daemon are counted uncompressed
+	EstimatedSize int64 `json:"estimatedSize"`
+}
+
+// GetPlan returns the plan for copying the tags from the initial image source and the tags from the image source to an
+// archive. Nothing is pulled or written. Layers are only known for Docker and zip image sources
+func GetPlan(s, initial ImageSource, copyTags, tags []string) (plan Plan, err error) {
+	plan.Tags = tags
+	plan.CopiedTags = copyTags
+
+	existing := func(hash string) (diz.Layer, bool) { return diz.Layer{Hash: hash}, false }
+	if z, ok := initial.(*ZipImageSource); ok {
+		existing = z.archive.GetLayerByHash
+		var manifests []diz.Manifest
+		if manifests, err = z.GetManifests(copyTags); err != nil {
+			return
+		}
+		for _, m := range manifests {
+			for _, l := range m.Layers {
+				plan.addLayer(z.archive.GetLayer(l), existing)
+			}
+		}
+	}
+
+	switch source := s.(type) {
+	case *dockerImageSource:
+		var local []string
+		if local, err = source.globTags(tags); err != nil {
+			return
+		}
+		plan.PulledTags = str.RemoveSlice(tags, local)
+		configs := make(map[string]bool, 0)
+		estimated := make(map[string]int64, 0)
+		for _, tag := range local {
+			var inspect types.ImageInspect
+			if inspect, _, err = source.cli.ImageInspectWithRaw(context.Background(), tag); err != nil {
+				return
+			}
+			if !configs[inspect.ID] {
+				configs[inspect.ID] = true
+				plan.addDaemonImage(inspect.Size, inspect.RootFS.Layers, existing, estimated)
+			}
+		}
+	case *ZipImageSource:
+		var manifests []diz.Manifest
+		if manifests, err = source.GetManifests(tags); err != nil {
+			return
+		}
+		for _, m := range manifests {
+			for _, l := range m.Layers {
+				plan.addLayer(source.archive.GetLayer(l), existing)
+			}
+		}
+	}
+
+	return
+}
+
+// addDaemonImage adds the layers of an image read from the Docker daemon to the plan. The daemon does not report layer
+// sizes, so the image size minus the sizes of the existing and already estimated layers is split between the new layers.
+// The estimated sizes are recorded by hash, so layers shared by several images are counted once
+func (p *Plan) addDaemonImage(size int64, diffIDs []string, existing func(hash string) (diz.Layer, bool), estimated map[string]int64) {
+	var uncounted []string
+	for _, diffID := range diffIDs {
+		hash := strings.TrimPrefix(diffID, "sha256:")
+		if l, ok := existing(hash); ok {
+			size -= l.Size
+			p.addLayer(l, existing)
+		} else if s, ok := estimated[hash]; ok {
+			size -= s
+		} else if !str.StringInSlice(hash, uncounted) {
+			uncounted = append(uncounted, hash)
+		}
+	}
+	if size < 0 {
+		size = 0
+	}
+	for i, hash := range uncounted {
+		s := size / int64(len(uncounted))
+		if i == len(uncounted)-1 {
+			s = size - s*int64(i)
+		}
+		estimated[hash] = s
+		p.NewLayers = append(p.NewLayers, diz.Layer{Hash: hash, Size: s})
+		p.EstimatedSize += s
+	}
+}
+
+// addLayer adds the layer to the new or existing layers of the plan, unless already added
+func (p *Plan) addLayer(l diz.Layer, existing func(hash string) (diz.Layer, bool)) {
+	for _, pl := range append(append([]diz.Layer(nil), p.NewLayers...), p.ExistingLayers...) {
+		if pl.Hash == l.Hash {
+			return
+		}
+	}
+	if e, ok := existing(l.Hash); ok {
+		p.ExistingLayers = append(p.ExistingLayers, e)
+		p.EstimatedSize += e.CompressedSize
+	} else {
+		p.NewLayers = append(p.NewLayers, l)
+		p.EstimatedSize += l.CompressedSize
+	}
+}
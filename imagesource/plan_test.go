@@ -0,0 +1,43 @@
+package imagesource
+
+import (
+	"testing"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanAddLayer(t *testing.T) {
+	existing := func(hash string) (diz.Layer, bool) {
+		if hash == "hx" {
+			return diz.Layer{Hash: "hx", Size: 100, CompressedSize: 10}, true
+		}
+		return diz.Layer{Hash: hash}, false
+	}
+
+	var plan Plan
+	plan.addLayer(diz.Layer{Hash: "hx"}, existing)
+	plan.addLayer(diz.Layer{Hash: "hy", Size: 200, CompressedSize: 20}, existing)
+	plan.addLayer(diz.Layer{Hash: "hy", Size: 200, CompressedSize: 20}, existing)
+	assert.Equal(t, []diz.Layer{{Hash: "hx", Size: 100, CompressedSize: 10}}, plan.ExistingLayers)
+	assert.Equal(t, []diz.Layer{{Hash: "hy", Size: 200, CompressedSize: 20}}, plan.NewLayers)
+	assert.Equal(t, int64(30), plan.EstimatedSize)
+}
+
+func TestPlanAddDaemonImage(t *testing.T) {
+	existing := func(hash string) (diz.Layer, bool) {
+		if hash == "hx" {
+			return diz.Layer{Hash: "hx", Size: 100, CompressedSize: 10}, true
+		}
+		return diz.Layer{Hash: hash}, false
+	}
+
+	var plan Plan
+	estimated := make(map[string]int64, 0)
+	plan.addDaemonImage(400, []string{"sha256:hx", "sha256:ha", "sha256:hb"}, existing, estimated)
+	// ha is shared with the first image and only hc is estimated
+	plan.addDaemonImage(350, []string{"sha256:hx", "sha256:ha", "sha256:hc"}, existing, estimated)
+	assert.Equal(t, []diz.Layer{{Hash: "hx", Size: 100, CompressedSize: 10}}, plan.ExistingLayers)
+	assert.Equal(t, []diz.Layer{{Hash: "ha", Size: 150}, {Hash: "hb", Size: 150}, {Hash: "hc", Size: 100}}, plan.NewLayers)
+	assert.Equal(t, int64(410), plan.EstimatedSize)
+}
@@ -0,0 +1,153 @@
+package imagesource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/str"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// PullOptions holds the options for pulling images from registries
+type PullOptions struct {
+	RetryOptions
+	// Parallel is the maximum number of concurrent pulls
+	Parallel int
+}
+
+// pullIfNeeded pulls the tags missing from the Docker daemon, using bounded concurrency, and summarizes any failures
+func (s *dockerImageSource) pullIfNeeded(tags []string) error {
+	if !s.pull {
+		return nil
+	}
+	existing, err := s.globTags(tags)
+	if err != nil {
+		return err
+	}
+	missing := str.RemoveSlice(tags, existing)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	parallel := s.options.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	failures := make(map[string]error, 0)
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				tag := dockerref.NormalizeReference(missing[i])
+				progress := fmt.Sprintf("[%d/%d] %s", i+1, len(missing), tag)
+				if err := s.options.retry("Pulling '"+tag+"'", func() error { return s.pullOne(tag, progress) }); err != nil {
+					fmt.Printf("%s: failed: %v\n", progress, err)
+					mutex.Lock()
+					failures[tag] = err
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range missing {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failures) == 0 {
+		fmt.Printf("Pulled %d images\n", len(missing))
+		return nil
+	}
+
+	failed := make([]string, 0, len(failures))
+	for tag := range failures {
+		failed = append(failed, tag)
+	}
+	sort.Strings(failed)
+	fmt.Printf("Pulled %d of %d images, %d failed:\n", len(missing)-len(failed), len(missing), len(failed))
+	for _, tag := range failed {
+		fmt.Printf("  %s: %v\n", tag, failures[tag])
+	}
+
+	return fmt.Errorf("failed to pull %s", strings.Join(failed, ", "))
+}
+
+// pullOne pulls a single image, decoding the progress stream from the Docker daemon
+func (s *dockerImageSource) pullOne(tag, progress string) error {
+	fmt.Printf("%s: pulling\n", progress)
+	reader, err := s.cli.ImagePull(context.Background(), tag, types.ImagePullOptions{RegistryAuth: getCredentials(dockerref.GetRegistry(tag))})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	layers := make(map[string]bool, 0)
+	completed := 0
+	err = decodeJSONMessages("pull "+tag, reader, func(m jsonmessage.JSONMessage) {
+		if m.ID == "" {
+			if m.Status != "" {
+				fmt.Printf("%s: %s\n", progress, m.Status)
+			}
+			return
+		}
+		switch m.Status {
+		case "Pulling fs layer", "Waiting":
+			if _, ok := layers[m.ID]; !ok {
+				layers[m.ID] = false
+			}
+		case "Pull complete", "Already exists":
+			if !layers[m.ID] {
+				layers[m.ID] = true
+				completed++
+				fmt.Printf("%s: %d/%d layers\n", progress, completed, len(layers))
+			}
+		}
+	})
+
+	return err
+}
+
+// DaemonError holds an error reported by the Docker daemon in a JSON message stream
+type DaemonError struct {
+	Operation string
+	Code      int
+	Message   string
+}
+
+func (e *DaemonError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s: %s (code %d)", e.Operation, e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s: %s", e.Operation, e.Message)
+}
+
+// decodeJSONMessages decodes the JSON message stream returned by the Docker daemon, calling the handler for each message. Errors reported in the stream are returned as DaemonError
+func decodeJSONMessages(operation string, rdr io.Reader, handler func(jsonmessage.JSONMessage)) error {
+	decoder := json.NewDecoder(rdr)
+	for {
+		var m jsonmessage.JSONMessage
+		if err := decoder.Decode(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if m.Error != nil {
+			return &DaemonError{Operation: operation, Code: m.Error.Code, Message: m.Error.Message}
+		} else if m.ErrorMessage != "" {
+			return &DaemonError{Operation: operation, Message: m.ErrorMessage}
+		}
+		handler(m)
+	}
+}
@@ -0,0 +1,22 @@
+package imagesource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeJSONMessages(t *testing.T) {
+	var streams []string
+	err := decodeJSONMessages("load", strings.NewReader(`{"stream":"Loaded image: foo:1\n"}{"stream":"Loaded image: bar:2\n"}`), func(m jsonmessage.JSONMessage) {
+		streams = append(streams, m.Stream)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Loaded image: foo:1\n", "Loaded image: bar:2\n"}, streams)
+
+	err = decodeJSONMessages("load", strings.NewReader(`{"stream":"Loaded image: foo:1\n"}{"errorDetail":{"message":"write /var/lib/docker/tmp: no space left on device"},"error":"write /var/lib/docker/tmp: no space left on device"}`), func(m jsonmessage.JSONMessage) {})
+	assert.Equal(t, &DaemonError{Operation: "load", Message: "write /var/lib/docker/tmp: no space left on device"}, err)
+	assert.Equal(t, "load: write /var/lib/docker/tmp: no space left on device", err.Error())
+}
@@ -0,0 +1,92 @@
+package imagesource
+
+import (
+	"context"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/docker/docker/api/types"
+)
+
+// ImageRecord describes a tagged image
+type ImageRecord struct {
+	Tag       string `json:"tag"`
+	Reference string `json:"reference"`
+	Digest    string `json:"digest,omitempty"`
+	ConfigID  string `json:"configId"`
+	Size      int64  `json:"size"`
+	Platform  string `json:"platform,omitempty"`
+}
+
+// GetImageRecords returns the records of the images with the given tags. Digests, sizes and platforms are only known for zip and Docker image sources
+func GetImageRecords(s ImageSource, tags []string) (result []ImageRecord, err error) {
+	var manifests []diz.Manifest
+	if manifests, err = s.GetManifests(tags); err != nil {
+		return
+	}
+
+	var digests map[string]string
+	z, isZip := s.(*ZipImageSource)
+	if isZip {
+		if digests, err = z.GetNormalizedTagsToDigest(); err != nil {
+			return
+		}
+	}
+	d, isDocker := s.(*dockerImageSource)
+
+	for _, m := range manifests {
+		var config diz.ImageConfig
+		var size int64
+		if isZip {
+			if config, err = z.GetImageConfig(m); err != nil {
+				return
+			}
+			for _, l := range m.Layers {
+				size += z.GetUncompressedSize(l)
+			}
+		}
+		for _, tag := range m.RepoTags {
+			r := ImageRecord{Tag: tag, Reference: dockerref.NormalizeReference(tag), ConfigID: "sha256:" + diz.GetConfig(m), Size: size, Platform: getPlatform(config.OS, config.Architecture, config.Variant)}
+			if digest, ok := digests[r.Reference]; ok {
+				r.Digest = dockerref.MakeDigestTag(digest)
+			}
+			if isDocker {
+				var inspect types.ImageInspect
+				if inspect, _, err = d.cli.ImageInspectWithRaw(context.Background(), tag); err != nil {
+					return
+				}
+				r.Size = inspect.Size
+				r.Platform = getPlatform(inspect.Os, inspect.Architecture, "")
+				r.Digest = getRepoDigest(inspect.RepoDigests, tag)
+			}
+			result = append(result, r)
+		}
+	}
+
+	return
+}
+
+func getPlatform(os, architecture, variant string) string {
+	if os == "" {
+		return ""
+	}
+	result := os + "/" + architecture
+	if variant != "" {
+		result += "/" + variant
+	}
+
+	return result
+}
+
+// getRepoDigest returns the digest of the repo digest for the repository of the tag
+func getRepoDigest(repoDigests []string, tag string) string {
+	registry, repository, _ := dockerref.NormalizeRegistryRepositoryTag(dockerref.SplitRegistryRepositoryTag(tag))
+	for _, rd := range repoDigests {
+		r, repo, digest := dockerref.SplitRegistryRepositoryTag(rd)
+		if r, repo, _ = dockerref.NormalizeRegistryRepositoryTag(r, repo, digest); r == registry && repo == repository {
+			return digest
+		}
+	}
+
+	return ""
+}
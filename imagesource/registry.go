@@ -0,0 +1,274 @@
+package imagesource
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/str"
+	"github.com/JohanLindvall/diz/util"
+
+	"github.com/ryanuber/go-glob"
+)
+
+const (
+	dockerHubRegistry = "docker.io"
+	dockerHubEndpoint = "registry-1.docker.io"
+)
+
+var (
+	challengeRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	linkRe      = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// registryClient holds the data for querying a Docker registry using the HTTP API V2
+type registryClient struct {
+	client *http.Client
+	tokens map[string]string
+	retry  RetryOptions
+}
+
+func newRegistryClient(retry RetryOptions) *registryClient {
+	return &registryClient{client: http.DefaultClient, tokens: make(map[string]string, 0), retry: retry}
+}
+
+// ListTags lists the tags of the repository in the registry
+func (c *registryClient) ListTags(registry, repository string) (result []string, err error) {
+	var response struct {
+		Tags []string `json:"tags"`
+	}
+	err = c.getAll(registry, fmt.Sprintf("/v2/%s/tags/list", repository), &response, func() {
+		result = append(result, response.Tags...)
+		response.Tags = nil
+	})
+
+	return
+}
+
+// ListRepositories lists the repositories in the registry catalog
+func (c *registryClient) ListRepositories(registry string) (result []string, err error) {
+	var response struct {
+		Repositories []string `json:"repositories"`
+	}
+	err = c.getAll(registry, "/v2/_catalog", &response, func() {
+		result = append(result, response.Repositories...)
+		response.Repositories = nil
+	})
+
+	return
+}
+
+// getAll gets the JSON document at the path, following pagination links and calling handle after each page
+func (c *registryClient) getAll(registry, path string, result interface{}, handle func()) error {
+	endpoint := registryEndpoint(registry)
+	for path != "" {
+		var b []byte
+		var link string
+		if err := c.retry.retry(fmt.Sprintf("Querying '%s%s'", registry, path), func() error {
+			response, err := c.get(registry, endpoint+path)
+			if err != nil {
+				return err
+			}
+			defer response.Body.Close()
+			if err = classifyResponse(response, fmt.Sprintf("registry %s for %s", registry, path)); err != nil {
+				return err
+			}
+			link = response.Header.Get("Link")
+			b, err = ioutil.ReadAll(response.Body)
+			return err
+		}); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, result); err != nil {
+			return err
+		}
+		handle()
+		path = ""
+		if match := linkRe.FindStringSubmatch(link); match != nil {
+			path = match[1]
+		}
+	}
+
+	return nil
+}
+
+// get performs an authenticated GET request, answering authentication challenges from the registry
+func (c *registryClient) get(registry, u string) (*http.Response, error) {
+	response, err := c.do(u, c.tokens[registry])
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+	challenge := response.Header.Get("WWW-Authenticate")
+	util.CopyAndClose(ioutil.Discard, response.Body)
+
+	var authorization string
+	if authorization, err = c.authorize(registry, challenge); err != nil {
+		return nil, err
+	}
+	c.tokens[registry] = authorization
+
+	return c.do(u, authorization)
+}
+
+func (c *registryClient) do(u, authorization string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	return c.client.Do(request)
+}
+
+// authorize returns the Authorization header value answering the challenge
+func (c *registryClient) authorize(registry, challenge string) (string, error) {
+	username, password, identityToken := getUsernamePassword(registry)
+	if strings.HasPrefix(challenge, "Basic") {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(username, password)
+		return request.Header.Get("Authorization"), nil
+	} else if !strings.HasPrefix(challenge, "Bearer") {
+		return "", fmt.Errorf("unsupported authentication challenge '%s' from registry %s", challenge, registry)
+	}
+
+	params := make(map[string]string, 0)
+	for _, match := range challengeRe.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	query := url.Values{}
+	for _, p := range []string{"service", "scope"} {
+		if v, ok := params[p]; ok {
+			query.Set(p, v)
+		}
+	}
+
+	var request *http.Request
+	var err error
+	if identityToken != "" {
+		// Identity tokens are exchanged for access tokens using the OAuth2 refresh token grant
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", identityToken)
+		query.Set("client_id", "diz")
+		if request, err = http.NewRequest(http.MethodPost, params["realm"], strings.NewReader(query.Encode())); err == nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else if request, err = http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil); err == nil && username != "" {
+		request.SetBasicAuth(username, password)
+	}
+	if err != nil {
+		return "", err
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request to %s returned %s", params["realm"], response.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+// registryEndpoint returns the base URL of the registry. Loopback registries are accessed over plain HTTP, like the Docker daemon does by default
+func registryEndpoint(registry string) string {
+	if registry == "" || registry == dockerHubRegistry {
+		registry = dockerHubEndpoint
+	}
+	host := strings.SplitN(registry, ":", 2)[0]
+	if host == "localhost" || strings.HasPrefix(host, "127.") {
+		return "http://" + registry
+	}
+	return "https://" + registry
+}
+
+// hasGlob returns true if the string contains glob characters
+func hasGlob(s string) bool {
+	return strings.Contains(s, "*")
+}
+
+// expandGlob expands the glob reference into references using the registry catalog and tag lists
+func (c *registryClient) expandGlob(globTag string) (result []string, err error) {
+	if !hasGlob(globTag) {
+		return []string{globTag}, nil
+	}
+	registry, repository, tag := dockerref.SplitRegistryRepositoryTag(globTag)
+	if repository == "" {
+		return nil, fmt.Errorf("invalid reference '%s'", globTag)
+	}
+	apiRegistry, _, _ := dockerref.NormalizeRegistryRepositoryTag(registry, repository, tag)
+
+	repositories := []string{repository}
+	if hasGlob(repository) {
+		var catalog []string
+		if catalog, err = c.ListRepositories(apiRegistry); err != nil {
+			return
+		}
+		repositories = nil
+		for _, r := range catalog {
+			if registry == "" {
+				_, r, _ = dockerref.FamiliarizeRegistryRepositorytag(apiRegistry, r, "")
+			}
+			if glob.Glob(repository, r) {
+				repositories = append(repositories, r)
+			}
+		}
+	}
+
+	for _, r := range repositories {
+		if !hasGlob(tag) {
+			result = append(result, dockerref.JoinRegistryRepositoryTag(registry, r, tag))
+			continue
+		}
+		_, apiRepository, _ := dockerref.NormalizeRegistryRepositoryTag(registry, r, tag)
+		var tags []string
+		if tags, err = c.ListTags(apiRegistry, apiRepository); err != nil {
+			return
+		}
+		for _, t := range tags {
+			result = append(result, dockerref.JoinRegistryRepositoryTag(registry, r, t))
+		}
+	}
+
+	return
+}
+
+// GlobTags expands the glob references against the registries and filters the result using the glob references, including negative ones
+func (c *registryClient) GlobTags(globTags []string) (result []string, err error) {
+	var candidates []string
+	for _, globTag := range globTags {
+		if strings.HasPrefix(globTag, "-") {
+			continue
+		}
+		var expanded []string
+		if expanded, err = c.expandGlob(globTag); err != nil {
+			return
+		}
+		for _, e := range expanded {
+			if str.IndexOf(candidates, e) == -1 {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+
+	result = diz.FilterImageTags(candidates, []string{}, globTags)
+
+	return
+}
@@ -0,0 +1,107 @@
+package imagesource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			assert.Equal(t, "registry", r.URL.Query().Get("service"))
+			fmt.Fprint(w, `{"token":"secret"}`)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="registry:catalog:*"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/_catalog":
+			fmt.Fprint(w, `{"repositories":["myorg/app","myorg/db","other/app"]}`)
+		case r.URL.Path == "/v2/myorg/app/tags/list" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/myorg/app/tags/list?last=1.1&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"name":"myorg/app","tags":["1.0","1.1"]}`)
+		case r.URL.Path == "/v2/myorg/app/tags/list":
+			fmt.Fprint(w, `{"name":"myorg/app","tags":["1.2","2.0"]}`)
+		case r.URL.Path == "/v2/myorg/db/tags/list":
+			fmt.Fprint(w, `{"name":"myorg/db","tags":["1.5"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestRegistryGlobTags(t *testing.T) {
+	server := newTestRegistry(t)
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	c := newRegistryClient(RetryOptions{})
+	result, err := c.GlobTags([]string{registry + "/myorg/app:1.*", "-" + registry + "/myorg/app:1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{registry + "/myorg/app:1.0", registry + "/myorg/app:1.2"}, result)
+
+	result, err = c.GlobTags([]string{registry + "/myorg/*:1.*", registry + "/other/app:latest"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{registry + "/myorg/app:1.0", registry + "/myorg/app:1.1", registry + "/myorg/app:1.2", registry + "/myorg/db:1.5", registry + "/other/app:latest"}, result)
+
+	_, err = c.GlobTags([]string{registry + "/missing:*"})
+	assert.NotNil(t, err)
+}
+
+func TestRegistryRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		retries int
+		ok      bool
+	}{
+		{"exhausted", 1, false},
+		{"succeeds", 2, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts++; attempts < 3 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				fmt.Fprint(w, `{"name":"app","tags":["1.0"]}`)
+			}))
+			defer server.Close()
+			registry := strings.TrimPrefix(server.URL, "http://")
+
+			result, err := newRegistryClient(RetryOptions{Retries: tc.retries}).ListTags(registry, "app")
+			if tc.ok {
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"1.0"}, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Nil(t, result)
+			}
+			assert.Equal(t, tc.retries+1, attempts)
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for msg, retryable := range map[string]bool{
+		"Error response from daemon: received unexpected HTTP status: 503 Service Unavailable": true,
+		"toomanyrequests: You have reached your pull rate limit":                               true,
+		"read tcp 10.0.0.1:443: read: connection reset by peer":                                true,
+		"manifest for app:1.0 not found: manifest unknown":                                     false,
+		"unauthorized: authentication required":                                                false,
+		"GET https://registry/v2/app/manifests/1.0: status 429 Too Many Requests":              true,
+		"layer sha256:5034292b not found in archive":                                           false,
+		"copying 429 bytes of /layer.tar failed: disk full":                                    false,
+	} {
+		_, ok := classify(errors.New(msg)).(*retryableError)
+		assert.Equal(t, retryable, ok, msg)
+	}
+}
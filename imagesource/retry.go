@@ -0,0 +1,85 @@
+package imagesource
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const maxBackoff = time.Minute
+
+var (
+	retryableRe = regexp.MustCompile(`(?i)(status:? (429|5\d\d)|\b429 Too Many|\b50[0234] (Internal Server Error|Bad Gateway|Service Unavailable|Gateway Time-?out)|toomanyrequests|too many requests|connection reset|connection refused|i/o timeout|TLS handshake timeout|unexpected EOF|temporary failure)`)
+)
+
+// RetryOptions holds the options for retrying failed registry operations
+type RetryOptions struct {
+	// Retries is the maximum number of retries after the first attempt
+	Retries int
+	// Backoff is the delay before the first retry. It doubles for every following retry
+	Backoff time.Duration
+}
+
+// retryableError wraps an error for an operation that may succeed if retried, optionally not before the given delay
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// classify wraps the error in a retryableError if it looks transient
+func classify(err error) error {
+	if _, ok := err.(*retryableError); err == nil || ok {
+		return err
+	}
+	if retryableRe.MatchString(err.Error()) {
+		return &retryableError{err: err}
+	}
+	return err
+}
+
+// classifyResponse returns an error for unsuccessful HTTP responses, honouring the Retry-After header for retryable ones
+func classifyResponse(response *http.Response, operation string) error {
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+	err := fmt.Errorf("%s returned %s", operation, response.Status)
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError {
+		result := &retryableError{err: err}
+		if seconds, e := strconv.Atoi(response.Header.Get("Retry-After")); e == nil {
+			result.retryAfter = time.Duration(seconds) * time.Second
+		} else if t, e := http.ParseTime(response.Header.Get("Retry-After")); e == nil {
+			result.retryAfter = time.Until(t)
+		}
+		return result
+	}
+	return err
+}
+
+// retry calls f until it succeeds, fails with a non-retryable error or the retries are exhausted, backing off exponentially between attempts
+func (o RetryOptions) retry(description string, f func() error) (err error) {
+	backoff := o.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = classify(f()); err == nil {
+			return
+		}
+		r, ok := err.(*retryableError)
+		if !ok || attempt >= o.Retries {
+			return
+		}
+		delay := backoff
+		if r.retryAfter > delay {
+			delay = r.retryAfter
+		}
+		fmt.Printf("%s failed (%v), retrying in %v\n", description, err, delay)
+		time.Sleep(delay)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/imagesource"
+	"github.com/docker/go-units"
+)
+
+// info prints the images of the archive with their sizes, and the archive totals
+func info(fn string) error {
+	z, err := imagesource.NewZipImageSource(fn)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	i, err := z.GetInfo()
+	if err != nil {
+		return err
+	}
+	return printOutput(i, i.Images, func() error { return printInfo(i) })
+}
+
+func printInfo(i diz.ArchiveInfo) error {
+	if m := i.Meta; m != nil {
+		// Archives written before the modification time was recorded were last written when created
+		written := m.Modified
+		if written.IsZero() {
+			written = m.Created
+		}
+		fmt.Printf("Format: version %d (%s), written by diz %s at %s\n", m.FormatVersion, strings.Join(m.Features, ", "), m.ToolVersion, written.Format("2006-01-02 15:04:05"))
+		if !m.Modified.IsZero() {
+			fmt.Printf("Created: %s\n", m.Created.Format("2006-01-02 15:04:05"))
+		}
+		if m.Source != nil {
+			fmt.Printf("Source: %s (Docker %s %s/%s)\n", m.Source.Host, m.Source.Version, m.Source.OS, m.Source.Architecture)
+		}
+		if m.KeepPrevious > 0 {
+			fmt.Printf("Keep previous: %d\n", m.KeepPrevious)
+		}
+		for _, k := range m.GetLabels() {
+			fmt.Printf("Label: %s=%s\n", k, m.Labels[k])
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE ID\tCREATED\tARCH\tLAYERS\tSIZE\tCOMPRESSED\tUNIQUE\tSHARED\tTAGS")
+	for _, im := range i.Images {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", shortID(im.Config), im.Created.Format("2006-01-02 15:04:05"), im.Architecture, im.Layers,
+			units.HumanSize(float64(im.Size)), units.HumanSize(float64(im.CompressedSize)), units.HumanSize(float64(im.UniqueSize)), units.HumanSize(float64(im.SharedSize)),
+			strings.Join(im.RepoTags, ", "))
+	}
+	w.Flush()
+	fmt.Printf("Total: %d images, %s, %s compressed (ratio %.2f)\n", len(i.Images), units.HumanSize(float64(i.Size)), units.HumanSize(float64(i.CompressedSize)), i.Ratio)
+
+	return nil
+}
+
+// why prints the tags keeping the layer in the archive
+func why(fn, layer string) error {
+	z, err := imagesource.NewZipImageSource(fn)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	tags := z.GetLayerTags(layer)
+	if len(tags) == 0 {
+		return fmt.Errorf("layer %s is not referenced", layer)
+	}
+	for _, t := range tags {
+		fmt.Println(t)
+	}
+
+	return nil
+}
@@ -2,41 +2,76 @@ package main
 
 import (
 	"compress/flate"
-	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/dockerhost"
 	"github.com/JohanLindvall/diz/dockerref"
 	"github.com/JohanLindvall/diz/hashzip"
 	"github.com/JohanLindvall/diz/imagesource"
 	"github.com/JohanLindvall/diz/str"
 	"github.com/JohanLindvall/diz/util"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+)
+
+const (
+	dockerName = "docker"
+	tarSuffix  = ".tar"
 )
 
 var (
-	cli             *client.Client
+	sourceCli       *client.Client
+	targetCli       *client.Client
 	fromZip         = flag.String("fromzip", "", "Set to read Docker tags and images from zip file")
 	tagFile         = flag.String("tagfile", "", "Set to read and write tags from file")
 	digestTags      = flag.Bool("digest", false, "If set, update tags to use repo digest")
 	pull            = flag.Bool("pull", false, "If set, pulls images from docker registry")
 	level           = flag.Int("level", flate.DefaultCompression, "Sets the deflate compression level (0-9)")
 	registryAddress = flag.String("registryAddress", "", "Sets the registry address of the given docker references")
+	parallel        = flag.Int("parallel", 4, "Sets the maximum number of concurrent pulls")
+	retries         = flag.Int("retries", 3, "Sets the number of retries for transient registry failures")
+	prune           = flag.Bool("prune", false, "If set, update only keeps the tags of the initial archive matching the given tags")
+	keepLast        = flag.Int("keep-last", 0, "Set to keep only the given number of most recent tags per repository on update")
+	keepWithin      = flag.String("keep-within", "", "Set to keep only tags of images created within the duration (e.g. 30d) per repository on update")
+	keepLatestMinor = flag.Bool("keep-latest-minor", false, "If set, keeps only the latest patch version of every semantic major.minor version per repository on update")
+	keepPrevious    = flag.Int("keep-previous", -1, "Set to keep the given number of previous images of tags moved by update, as hidden <tag>@prev<n> tags for rollback. 0 drops them. The number is stored in the archive and used by later updates. Defaults to the stored number, or else the number already kept, which is none for archives without previous images")
+	conflict        = flag.String("conflict", diz.ConflictFail, "Sets how merge resolves tags referring to different images in the inputs (first, last or fail)")
+	output          = flag.String("o", "", "Sets the output format of list, info, diff and digests (json, yaml, table or template=<Go template>), defaults to text")
+	inPlace         = flag.Bool("in-place", false, "If set, update appends to the initial archive instead of rewriting it. The output must be the initial archive")
+	resume          = flag.Bool("resume", false, "If set, create writes one tag at a time, keeping its progress in <file>.partial and <file>.checkpoint, and continues an interrupted create")
+	reproducible    = flag.Bool("reproducible", false, "If set, writes byte-identical zip archives for the same images, sorting the files and manifests and setting the modification times to SOURCE_DATE_EPOCH")
+	dryRun          = flag.Bool("dry-run", false, "If set, prints what would be done without writing anything")
+	force           = flag.Bool("force", false, "If set, restores all images, including those already present in the Docker daemon")
+	batchSize       = flag.String("batch-size", "0", "Sets the maximum uncompressed size of a restore batch (e.g. 10GB), 0 for a single batch")
+	batchParallel   = flag.Int("batch-parallel", 1, "Sets the maximum number of restore batches loaded concurrently")
+	stateFile       = flag.String("statefile", "", "Set to record restored batches in the file, so that an interrupted restore can be resumed")
+	hostList        = flag.String("hosts", "", "Set to restore to the given comma-separated Docker hosts (host URLs or context names) concurrently")
+	hostsFile       = flag.String("hostsfile", "", "Set to restore to the Docker hosts (host URLs or context names) read from file, one per line")
+	dockerHost      = flag.String("host", "", "Sets the Docker daemon host (e.g. tcp://host:2376), overriding contexts and DOCKER_HOST")
+	dockerContext   = flag.String("context", "", "Sets the Docker context, overriding DOCKER_CONTEXT and the current context")
+	tlsCACert       = flag.String("tlscacert", "", "Sets the CA certificate used for verifying the Docker daemon given by -host")
+	tlsCert         = flag.String("tlscert", "", "Sets the TLS client certificate used for the Docker daemon given by -host")
+	tlsKey          = flag.String("tlskey", "", "Sets the TLS client key used for the Docker daemon given by -host")
+	sourceDaemon    = flag.String("source", "", "Sets the Docker daemon (host URL or context name) to read images from, defaults to -host or -context")
+	targetDaemon    = flag.String("target", "", "Sets the Docker daemon (host URL or context name) to restore images to, defaults to -host or -context")
+	backoff         = flag.Duration("backoff", time.Second, "Sets the initial delay between retries, doubling for every retry")
 )
 
 func main() {
 	flag.Parse()
 
-	ccli, err := client.NewEnvClient()
-	if err != nil {
-		panic(err)
+	var err error
+	if *reproducible {
+		if sourceDateEpoch, err = getSourceDateEpoch(); err != nil {
+			panic(err)
+		}
 	}
-	cli = ccli
-
 	args := flag.Args()
 	switch args[0] {
 	case "list":
@@ -47,6 +82,24 @@ func main() {
 		err = update(args[1], args[2], getTags(args[3:]))
 	case "restore":
 		err = restore(getTags(args[1:]))
+	case "rm":
+		err = rm(args[1], args[2], getTags(args[3:]))
+	case "merge":
+		err = merge(args[1], args[2:])
+	case "info", "stats":
+		err = info(args[1])
+	case "why":
+		err = why(args[1], args[2])
+	case "rollback":
+		err = rollback(args[1], args[2], args[3], args[4:])
+	case "history":
+		err = history(args[1], args[2:])
+	case "diff":
+		err = diff(args[1], args[2])
+	case "repair":
+		err = repair(args[1], args[2])
+	case "copy":
+		err = copyImages(args[1], args[2], getTags(args[3:]))
 	case "serve":
 		err = serve(args[1])
 	default:
@@ -59,12 +112,32 @@ func main() {
 }
 
 func create(fn string, globTags []string) error {
-	return createUpdate(imagesource.NewNullImageSource(), fn, globTags)
+	if *resume && fn == "-" {
+		return errors.New("-resume cannot write to standard output")
+	}
+	return createUpdate(diz.OperationCreate, imagesource.NewNullImageSource(), fn, globTags)
 }
 
 func update(initial string, fn string, globTags []string) error {
+	if *resume {
+		return errors.New("-resume is only supported by create")
+	}
+	if *inPlace && (fn != initial || isDocker(fn) || isTar(fn)) {
+		return errors.New("-in-place requires the output to be the initial zip archive")
+	}
+	if *inPlace && *reproducible {
+		return errors.New("-in-place cannot be combined with -reproducible")
+	}
+	if *inPlace {
+		// Restore the archive if an earlier update in place was interrupted
+		if recovered, err := hashzip.RecoverAppend(fn); err != nil {
+			return err
+		} else if recovered {
+			fmt.Printf("Recovered '%s' from an interrupted update\n", fn)
+		}
+	}
 	if initialSource, err := getNamedImageSource(initial); err == nil {
-		err = createUpdate(initialSource, fn, globTags)
+		err = createUpdate(diz.OperationUpdate, initialSource, fn, globTags)
 		if er := initialSource.Close(); err == nil {
 			err = er
 		}
@@ -74,73 +147,243 @@ func update(initial string, fn string, globTags []string) error {
 	}
 }
 
-func createUpdate(initial imagesource.ImageSource, fn string, globTags []string) error {
-	if s, err := getImageSource(); err != nil {
+// createUpdate writes the images with the given tags, and those copied from the initial image source, to the output
+// file. The operation is recorded in the history, which is carried forward from an initial archive
+func createUpdate(operation string, initial imagesource.ImageSource, fn string, globTags []string) error {
+	s, err := getImageSource()
+	if err != nil {
 		return err
-	} else {
-		defer s.Close()
-		if tags, err := s.GlobTags(globTags); err != nil {
+	}
+	defer s.Close()
+
+	tags, err := s.GlobTags(globTags)
+	if err != nil {
+		return err
+	}
+
+	// Copy tags and contents from initial image source (if there is one). When pruning, only tags matching the globs are kept
+	copyGlobs := []string{"*"}
+	if *prune {
+		copyGlobs = globTags
+	}
+	var copyTags []string
+	if copyTags, err = initial.GlobTags(copyGlobs); err != nil {
+		return err
+	}
+
+	// Remove tags to be updated
+	copyTags = str.RemoveSlice(copyTags, tags)
+
+	z, isZip := initial.(*imagesource.ZipImageSource)
+	if isZip {
+		if copyTags, err = applyRetention(z, copyTags, tags); err != nil {
+			return err
+		}
+	}
+
+	if *dryRun {
+		if plan, err := imagesource.GetPlan(s, initial, copyTags, tags); err != nil {
 			return err
 		} else {
-			var out *os.File
-			if out, err = getOutFile(fn); err != nil {
-				return err
-			}
-			defer out.Close()
-			zipWriter := hashzip.NewWriterLevel(out, *level)
+			return printOutput(plan, nil, func() error { return printPlan(plan) })
+		}
+	}
 
-			// Copy tags and contents from initial image source (if there is one)
-			var copyTags []string
-			if copyTags, err = initial.GlobTags([]string{"*"}); err != nil {
-				return err
-			}
+	if *resume {
+		return createResumable(s, fn, tags, getMeta(*fromZip, getSourceMeta(s)))
+	}
+
+	// The history is read before writing, as appending in place overwrites it
+	var oldManifests []diz.Manifest
+	var history []diz.HistoryEntry
+	if isZip {
+		oldManifests = z.Manifests()
+		if history, err = z.GetHistory(); err != nil {
+			return err
+		}
+	}
+
+	zipWriter, out, err := getZipWriter(fn, *inPlace)
+	if err != nil {
+		return err
+	}
+	defer out.Discard()
 
-			// Remove tags to be updated
-			copyTags = str.RemoveSlice(copyTags, tags)
-			var m1, m2 []diz.Manifest
-			if m1, err = initial.CopyToZip(zipWriter, copyTags); err != nil {
-				return err
+	var m1, m2, unchanged []diz.Manifest
+	if m1, err = initial.CopyToZip(zipWriter, copyTags); err != nil {
+		return err
+	}
+
+	// Copy images already in the initial archive, instead of saving them again
+	if isZip && len(tags) > 0 {
+		if unchanged, tags, err = getUnchanged(z, s, tags); err != nil {
+			return err
+		}
+		if err = z.CopyManifestsToZip(zipWriter, unchanged); err != nil {
+			return err
+		}
+	}
+
+	if len(tags) > 0 {
+		if isZip {
+			m2, err = z.CopyFromSource(zipWriter, s, tags)
+		} else {
+			m2, err = s.CopyToZip(zipWriter, tags)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// The number of previous images to keep is stored in the metadata, used by later updates without -keep-previous
+	meta := getMeta(*fromZip, getSourceMeta(s), getSourceMeta(initial))
+	keep := *keepPrevious
+	if keep < 0 && meta.KeepPrevious > 0 {
+		keep = meta.KeepPrevious
+	} else if keep >= 0 {
+		meta.KeepPrevious = keep
+	}
+
+	manifests := diz.MergeManifests(diz.MergeManifests(m1, unchanged), m2)
+	if isZip {
+		previous := diz.KeepPrevious(oldManifests, manifests, keep)
+		if err = z.CopyManifestsToZip(zipWriter, previous); err != nil {
+			return err
+		}
+		manifests = diz.MergeManifests(manifests, previous)
+	}
+	err = diz.WriteManifests(manifests, zipWriter)
+	if err == nil {
+		err = diz.WriteMeta(meta, zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteHistory(getHistory(history, operation, oldManifests, manifests), zipWriter)
+	}
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	if err == nil {
+		err = updateTags(fn)
+	}
+	return err
+}
+
+// applyRetention applies the retention policy to the tags copied from the initial archive. Updated tags are always kept
+func applyRetention(initial *imagesource.ZipImageSource, copyTags, tags []string) ([]string, error) {
+	policy, err := getRetentionPolicy()
+	if err != nil || policy.IsEmpty() {
+		return copyTags, err
+	}
+
+	var images []diz.TaggedImage
+	for _, m := range initial.Manifests() {
+		config, err := initial.GetImageConfig(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range m.RepoTags {
+			if str.StringInSlice(tag, copyTags) {
+				images = append(images, diz.TaggedImage{Tag: tag, Created: config.Created})
 			}
+		}
+	}
+	for _, tag := range tags {
+		images = append(images, diz.TaggedImage{Tag: tag, Pinned: true})
+	}
 
-			if m2, err = s.CopyToZip(zipWriter, tags); err != nil {
-				return err
-			} else {
-				err = diz.WriteManifests(diz.MergeManifests(m1, m2), zipWriter)
-				if er := zipWriter.Close(); err == nil {
-					err = er
-				}
-				if err == nil {
-					err = updateTags(fn)
-				}
-				return err
+	remove := policy.Apply(images, time.Now())
+	if len(remove) > 0 {
+		verb := "Removing"
+		if *dryRun {
+			verb = "Would remove"
+		}
+		fmt.Printf("%s %d tags by retention policy: %s\n", verb, len(remove), strings.Join(remove, ", "))
+	}
+
+	return str.RemoveSlice(copyTags, remove), nil
+}
+
+func printPlan(plan imagesource.Plan) error {
+	fmt.Printf("Would add %d tags: %s\n", len(plan.Tags), strings.Join(plan.Tags, ", "))
+	if len(plan.CopiedTags) > 0 {
+		fmt.Printf("Would copy %d tags from the initial archive: %s\n", len(plan.CopiedTags), strings.Join(plan.CopiedTags, ", "))
+	}
+	if len(plan.PulledTags) > 0 {
+		fmt.Printf("Would pull %d tags: %s\n", len(plan.PulledTags), strings.Join(plan.PulledTags, ", "))
+	}
+	var compressed int64
+	for _, l := range plan.ExistingLayers {
+		compressed += l.CompressedSize
+	}
+	fmt.Printf("New layers: %d\n", len(plan.NewLayers))
+	fmt.Printf("Existing layers: %d (%s compressed)\n", len(plan.ExistingLayers), units.HumanSize(float64(compressed)))
+	fmt.Printf("Estimated size: %s\n", units.HumanSize(float64(plan.EstimatedSize)))
+
+	return nil
+}
+
+func getRetentionPolicy() (policy diz.RetentionPolicy, err error) {
+	policy.KeepLast = *keepLast
+	policy.KeepLatestMinor = *keepLatestMinor
+	if *keepWithin != "" {
+		policy.KeepWithin, err = diz.ParseAge(*keepWithin)
+	}
+	return
+}
+
+// getUnchanged returns the manifests of the images in the initial archive having the same config as in the source,
+// using the tags from the source, and the remaining tags which need to be copied from the source
+func getUnchanged(initial *imagesource.ZipImageSource, s imagesource.ImageSource, tags []string) (unchanged []diz.Manifest, changed []string, err error) {
+	var sourceManifests []diz.Manifest
+	if sourceManifests, err = s.GetManifests(tags); err != nil {
+		return
+	}
+	changed = tags
+	for _, sm := range sourceManifests {
+		for _, im := range initial.Manifests() {
+			if im.Config == sm.Config {
+				unchanged = append(unchanged, diz.Manifest{Config: im.Config, Layers: im.Layers, RepoTags: sm.RepoTags})
+				changed = str.RemoveSlice(changed, sm.RepoTags)
+				break
 			}
 		}
 	}
+	if len(unchanged) > 0 {
+		fmt.Printf("Copying %d unchanged images from the initial archive\n", len(unchanged))
+	}
+
+	return
 }
 
-func restore(globTags []string) error {
-	if s, err := getImageSource(); err != nil {
+func copyImages(from, to string, globTags []string) error {
+	if isDocker(to) && diz.MatchesPrevious(globTags) {
+		return errPreviousToDocker
+	} else if s, err := getNamedImageSource(from); err != nil {
 		return err
 	} else {
 		defer s.Close()
 		if tags, err := s.GlobTags(globTags); err != nil {
 			return err
+		} else if history, err := getSourceHistory(s); err != nil {
+			return err
+		} else if sink, out, err := getNamedImageSink(to, getMeta(from, getSourceMeta(s)), history); err != nil {
+			return err
 		} else {
-			fmt.Printf("Restoring %s\n", strings.Join(tags, ", "))
-			if rdr, err := s.ReadTar(tags); err != nil {
-				return err
-			} else {
-				defer rdr.Close()
-				if response, err := cli.ImageLoad(context.Background(), rdr, false); err != nil {
-					return err
-				} else {
-					response.Body.Close()
-				}
+			defer out.Discard()
+			fmt.Printf("Copying %s\n", strings.Join(tags, ", "))
+			err = imagesource.Copy(s, sink, tags)
+			if er := sink.Close(); err == nil {
+				err = er
+			}
+			if err == nil {
+				err = out.Commit()
 			}
+			return err
 		}
 	}
-
-	return nil
 }
 
 func list(tags []string) error {
@@ -150,10 +393,14 @@ func list(tags []string) error {
 		defer s.Close()
 		if result, err := s.GlobTags(tags); err != nil {
 			return err
-		} else {
+		} else if *output == "" {
 			for _, r := range result {
 				fmt.Println(r)
 			}
+		} else if records, err := imagesource.GetImageRecords(s, result); err != nil {
+			return err
+		} else {
+			return printOutput(records, nil, nil)
 		}
 	}
 	return nil
@@ -164,21 +411,89 @@ func getImageSource() (imagesource.ImageSource, error) {
 }
 
 func getNamedImageSource(fn string) (imagesource.ImageSource, error) {
-	if fn == "" {
-		return imagesource.NewDockerImageSource(cli, *pull), nil
+	if isDocker(fn) {
+		if cli, err := getSourceClient(); err != nil {
+			return nil, err
+		} else {
+			return imagesource.NewDockerImageSource(cli, *pull, getPullOptions()), nil
+		}
+	} else if isTar(fn) {
+		return imagesource.NewTarImageSource(fn)
 	} else {
 		return imagesource.NewZipImageSource(fn)
 	}
 }
 
-func getOutFile(fn string) (out *os.File, err error) {
-	if fn == "-" {
-		out = os.Stdout
+// getSourceClient returns the client of the Docker daemon images are read from, resolved on first use
+func getSourceClient() (*client.Client, error) {
+	var err error
+	if sourceCli == nil {
+		sourceCli, err = getClient(*sourceDaemon)
+	}
+	return sourceCli, err
+}
+
+// getTargetClient returns the client of the Docker daemon images are restored to, resolved on first use
+func getTargetClient() (*client.Client, error) {
+	var err error
+	if targetCli == nil {
+		targetCli, err = getClient(*targetDaemon)
+	}
+	return targetCli, err
+}
+
+// getClient returns a Docker client for the daemon specification (a host URL or context name), falling back to the -host and -context flags
+func getClient(spec string) (*client.Client, error) {
+	var endpoint dockerhost.Endpoint
+	var err error
+	if spec != "" {
+		endpoint, err = dockerhost.ResolveSpec(spec, getTLSOptions())
 	} else {
-		out, err = os.Create(fn)
+		endpoint, err = dockerhost.Resolve(*dockerHost, *dockerContext, getTLSOptions())
 	}
+	if err != nil {
+		return nil, err
+	}
+	return dockerhost.NewClient(endpoint)
+}
 
-	return
+func getTLSOptions() dockerhost.TLSOptions {
+	return dockerhost.TLSOptions{CACert: *tlsCACert, Cert: *tlsCert, Key: *tlsKey}
+}
+
+func getPullOptions() imagesource.PullOptions {
+	return imagesource.PullOptions{Parallel: *parallel, RetryOptions: imagesource.RetryOptions{Retries: *retries, Backoff: *backoff}}
+}
+
+// getNamedImageSink returns the image sink and, for files, the output file to commit when the sink is closed. The
+// metadata is written to zip archives
+func getNamedImageSink(fn string, meta *diz.Meta, history []diz.HistoryEntry) (imagesource.ImageSink, *outFile, error) {
+	if isDocker(fn) {
+		if cli, err := getTargetClient(); err != nil {
+			return nil, nil, err
+		} else {
+			return imagesource.NewDockerImageSink(cli), nil, nil
+		}
+	} else if *reproducible && fn == "-" {
+		return nil, nil, errReproducibleStdout
+	} else if out, err := getOutFile(fn); err != nil {
+		return nil, nil, err
+	} else if isTar(fn) {
+		return imagesource.NewTarImageSink(out), out, nil
+	} else {
+		out.sorted = *reproducible
+		return imagesource.NewZipImageSink(out, *level, meta, history), out, nil
+	}
+}
+
+// isDocker returns true if the name refers to the Docker daemon rather than a file
+func isDocker(fn string) bool {
+	return fn == "" || fn == dockerName
+}
+
+// isTar returns true if the name refers to a docker-archive tar file
+func isTar(fn string) bool {
+	return strings.HasSuffix(strings.ToLower(fn), tarSuffix)
 }
 
 func getTags(tags []string) []string {
@@ -208,7 +523,15 @@ func updateTags(zipFile string) error {
 		return err
 	}
 
-	if *tagFile == "" {
+	if *tagFile == "" && *output != "" {
+		var tags []string
+		if tags, err = zf.GlobTags([]string{"*"}); err == nil {
+			var records []imagesource.ImageRecord
+			if records, err = imagesource.GetImageRecords(zf, tags); err == nil {
+				err = printOutput(records, nil, nil)
+			}
+		}
+	} else if *tagFile == "" {
 		for tag, digest := range tagsToDigest {
 			fmt.Printf("%s=%s\n", tag, digest)
 		}
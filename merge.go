@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/imagesource"
+)
+
+// merge writes the images of all input archives to a single archive. Shared image files are copied once
+func merge(fn string, inputs []string) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input archives")
+	}
+
+	var sources []*imagesource.ZipImageSource
+	defer func() {
+		for _, z := range sources {
+			z.Close()
+		}
+	}()
+
+	var sets [][]diz.Manifest
+	var metas []*diz.Meta
+	var histories [][]diz.HistoryEntry
+	for _, input := range inputs {
+		z, err := imagesource.NewZipImageSource(input)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, z)
+		sets = append(sets, z.Manifests())
+		metas = append(metas, z.Meta())
+		if h, err := z.GetHistory(); err != nil {
+			return err
+		} else {
+			histories = append(histories, h)
+		}
+	}
+
+	sets, conflicts, err := diz.ResolveConflicts(sets, *conflict)
+	if err != nil {
+		return err
+	}
+	for _, c := range conflicts {
+		fmt.Printf("Tag %s refers to different images, using the one from %s\n", c.Tag, inputs[c.Winner])
+	}
+
+	zipWriter, out, err := getZipWriter(fn, false)
+	if err != nil {
+		return err
+	}
+	defer out.Discard()
+	var manifests []diz.Manifest
+	for i, z := range sources {
+		for _, f := range z.GetDifferingFiles(zipWriter, sets[i]) {
+			fmt.Printf("File %s in %s differs from a previous input, keeping the first\n", f, inputs[i])
+		}
+		if err = z.CopyManifestsToZip(zipWriter, sets[i]); err != nil {
+			break
+		}
+		manifests = diz.MergeManifests(manifests, sets[i])
+	}
+	if err == nil {
+		err = diz.WriteManifests(manifests, zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteMeta(getMeta(inputs[0], metas...), zipWriter)
+	}
+	if history := diz.MergeHistories(histories...); err == nil && history != nil {
+		err = diz.WriteHistory(history, zipWriter)
+	}
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+
+	return err
+}
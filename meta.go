@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/imagesource"
+)
+
+// Version is the diz version recorded in the archives, set at build time with -ldflags "-X main.Version=<version>"
+var Version = "dev"
+
+// labels holds the -label flags
+var labels = labelsValue{}
+
+func init() {
+	flag.Var(labels, "label", "Adds a label key=value to the metadata of the written archive, can be repeated")
+}
+
+type labelsValue map[string]string
+
+func (l labelsValue) String() string {
+	var result []string
+	for k, v := range l {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+func (l labelsValue) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("bad label %s, expected key=value", s)
+	}
+	l[kv[0]] = kv[1]
+	return nil
+}
+
+// getSourceMeta returns the metadata of the image source if it is an archive
+func getSourceMeta(s imagesource.ImageSource) *diz.Meta {
+	if z, ok := s.(*imagesource.ZipImageSource); ok {
+		return z.Meta()
+	}
+	return nil
+}
+
+// getMeta returns the metadata of an archive written with images from the source. The labels, the creation time of the
+// oldest archive, the largest number of previous images to keep and, unless the source is the Docker daemon, the
+// source of the inherited metadata are kept
+func getMeta(source string, inherited ...*diz.Meta) *diz.Meta {
+	meta := diz.NewMeta(Version)
+	if *reproducible {
+		meta.Created = sourceDateEpoch
+		meta.Modified = meta.Created
+	}
+	if isDocker(source) {
+		if cli, err := getSourceClient(); err == nil {
+			meta.Source = &diz.SourceInfo{Host: cli.DaemonHost()}
+			if v, err := cli.ServerVersion(context.Background()); err == nil {
+				meta.Source.Version = v.Version
+				meta.Source.OS = v.Os
+				meta.Source.Architecture = v.Arch
+			}
+		}
+	}
+	for _, m := range inherited {
+		if m == nil {
+			continue
+		}
+		if meta.Source == nil {
+			meta.Source = m.Source
+		}
+		if !m.Created.IsZero() && m.Created.Before(meta.Created) {
+			meta.Created = m.Created
+		}
+		for k, v := range m.Labels {
+			meta.Labels[k] = v
+		}
+		if m.KeepPrevious > meta.KeepPrevious {
+			meta.KeepPrevious = m.KeepPrevious
+		}
+	}
+	for k, v := range labels {
+		meta.Labels[k] = v
+	}
+
+	return meta
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/hashzip"
+)
+
+var (
+	// errReproducibleStdout is returned for reproducible archives written to standard output, which cannot be sorted
+	errReproducibleStdout = errors.New("-reproducible cannot write to standard output")
+	// sourceDateEpoch is the modification time of reproducible archives, parsed from SOURCE_DATE_EPOCH at startup
+	sourceDateEpoch time.Time
+)
+
+// outFile is an output file written to a temporary file next to it, which atomically replaces the output file when
+// committed. Readers never see a partially written output file
+type outFile struct {
+	*os.File
+	name      string
+	closed    bool
+	committed bool
+	// appender is set when appending to the output file in place
+	appender *hashzip.Writer
+	// sorted is set to sort the zip archive when committed
+	sorted bool
+}
+
+func getOutFile(fn string) (*outFile, error) {
+	if fn == "-" {
+		return &outFile{File: os.Stdout}, nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &outFile{File: f, name: fn}, nil
+}
+
+// getZipWriter returns a zip writer for the output file. If appending, the existing archive is appended to in place
+func getZipWriter(fn string, appending bool) (*hashzip.Writer, *outFile, error) {
+	if *reproducible && fn == "-" {
+		return nil, nil, errReproducibleStdout
+	}
+	if !appending {
+		out, err := getOutFile(fn)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.sorted = *reproducible
+		return hashzip.NewWriterLevel(out, *level), out, nil
+	}
+
+	f, err := os.OpenFile(fn, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := hashzip.NewAppendWriterLevel(f, *level, diz.ManifestFiles())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return w, &outFile{File: f, appender: w}, nil
+}
+
+// Close closes the file, keeping the temporary file until committed or discarded
+func (o *outFile) Close() error {
+	if o.closed || o.File == os.Stdout {
+		return nil
+	}
+	o.closed = true
+	return o.File.Close()
+}
+
+// Commit closes the file and replaces the output file with it, unless appending in place
+func (o *outFile) Commit() error {
+	if o == nil {
+		return nil
+	}
+	if err := o.Close(); err != nil {
+		return err
+	}
+	if o.sorted {
+		if err := sortArchive(o.File.Name()); err != nil {
+			return err
+		}
+	}
+	if o.name != "" {
+		mode := os.FileMode(0644)
+		if fi, err := os.Stat(o.name); err == nil {
+			mode = fi.Mode().Perm()
+		}
+		if err := os.Chmod(o.File.Name(), mode); err != nil {
+			return err
+		}
+		if err := os.Rename(o.File.Name(), o.name); err != nil {
+			return err
+		}
+	}
+	o.committed = true
+	return nil
+}
+
+// Discard closes the file and removes it unless committed. Appended data is removed, restoring the original archive
+func (o *outFile) Discard() {
+	if o == nil {
+		return
+	}
+	if !o.committed && o.appender != nil && !o.closed {
+		o.appender.Abort()
+	}
+	o.Close()
+	if !o.committed && o.name != "" {
+		os.Remove(o.File.Name())
+	}
+}
+
+// sortArchive rewrites the zip archive with the files sorted and the modification times set to SOURCE_DATE_EPOCH. The
+// sorted archive is written to a temporary file next to it, so twice the size of the archive is needed on disk
+func sortArchive(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zipReader, err := hashzip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	out, err := getOutFile(fn)
+	if err != nil {
+		return err
+	}
+	defer out.Discard()
+	zipWriter := hashzip.NewWriterLevel(out, *level)
+	zipWriter.SetModified(sourceDateEpoch)
+	err = diz.CopySorted(zipReader, zipWriter)
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+
+	return err
+}
+
+// getSourceDateEpoch returns the time given in seconds since the epoch by SOURCE_DATE_EPOCH, or the zero time
+func getSourceDateEpoch() (time.Time, error) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err != nil {
+		return time.Time{}, fmt.Errorf("bad SOURCE_DATE_EPOCH %s: %v", s, err)
+	} else {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+}
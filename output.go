@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const templatePrefix = "template="
+
+// printOutput prints the value in the format given by -o. The table and template formats print every item of items, or
+// the value itself if items is nil. The text function prints the default output
+func printOutput(v interface{}, items interface{}, text func() error) error {
+	if items == nil {
+		items = v
+	}
+
+	switch {
+	case *output == "":
+		return text()
+	case *output == "json":
+		return printJSON(v)
+	case *output == "yaml":
+		return printYAML(v)
+	case *output == "table":
+		return printTable(items)
+	case strings.HasPrefix(*output, templatePrefix):
+		return printTemplate(items, (*output)[len(templatePrefix):])
+	default:
+		return fmt.Errorf("unknown output format '%s'", *output)
+	}
+}
+
+// printJSON prints the value as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printYAML prints the value as YAML, using the JSON field names
+func printYAML(v interface{}) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err = yaml.Unmarshal(js, &node); err != nil {
+		return err
+	}
+	clearStyle(&node)
+
+	return yaml.NewEncoder(os.Stdout).Encode(&node)
+}
+
+// clearStyle resets the flow and quoting styles of the JSON document, giving block style YAML
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		clearStyle(n)
+	}
+}
+
+// printTemplate executes the Go template for every item, like docker images --format
+func printTemplate(items interface{}, text string) error {
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			js, err := json.Marshal(v)
+			return string(js), err
+		},
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range getItems(items) {
+		if err = tmpl.Execute(os.Stdout, item.Interface()); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// printTable prints the items as a table with one column for every field. A single struct is printed with one row per field.
+// The header row of a slice is printed even if it is empty
+func printTable(items interface{}) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if v := reflect.Indirect(reflect.ValueOf(items)); v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			fmt.Fprintf(w, "%s\t%s\n", getColumnName(v.Type().Field(i)), formatValue(v.Field(i)))
+		}
+	} else {
+		t := v.Type().Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		var columns []string
+		for f := 0; f < t.NumField(); f++ {
+			columns = append(columns, getColumnName(t.Field(f)))
+		}
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+		for _, item := range getItems(items) {
+			item = reflect.Indirect(item)
+			columns = nil
+			for f := 0; f < item.NumField(); f++ {
+				columns = append(columns, formatValue(item.Field(f)))
+			}
+			fmt.Fprintln(w, strings.Join(columns, "\t"))
+		}
+	}
+
+	return w.Flush()
+}
+
+// getItems returns the elements of the slice, or the value itself if it is not a slice
+func getItems(items interface{}) (result []reflect.Value) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return []reflect.Value{v}
+	}
+	for i := 0; i < v.Len(); i++ {
+		result = append(result, v.Index(i))
+	}
+
+	return
+}
+
+// getColumnName returns the upper-cased JSON name of the field
+func getColumnName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+
+	return strings.ToUpper(name)
+}
+
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case []string:
+		return strings.Join(value, ",")
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	if v.Kind() == reflect.Slice {
+		return fmt.Sprint(v.Len())
+	}
+
+	return fmt.Sprint(v.Interface())
+}
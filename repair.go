@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/hashzip"
+)
+
+// repair writes the readable images of the possibly damaged archive to a clean archive, recomputing the hashes and
+// rebuilding missing manifests
+func repair(in, fn string) error {
+	file, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	zipReader, err := hashzip.NewReader(file, fi.Size())
+	if err != nil {
+		fmt.Printf("Cannot read the central directory of %s (%v), scanning the local headers\n", in, err)
+		zipReader = hashzip.NewSalvageReader(file, fi.Size())
+	}
+
+	zipWriter, out, err := getZipWriter(fn, false)
+	if err != nil {
+		return err
+	}
+	defer out.Discard()
+	result, err := diz.RepairArchive(zipReader, zipWriter)
+	if err == nil {
+		err = diz.WriteManifests(result.Manifests, zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteMeta(getMeta(in, result.Meta), zipWriter)
+	}
+	if err == nil && result.History != nil {
+		err = diz.WriteHistory(result.History, zipWriter)
+	}
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, f := range result.Dropped {
+		fmt.Printf("Dropped unreadable or corrupt file %s\n", f)
+	}
+	for _, c := range result.Incomplete {
+		fmt.Printf("Dropped image %s with missing layers\n", c)
+	}
+	fmt.Printf("Repaired %d images, %d rebuilt, %d without tags\n", len(result.Manifests), result.Rebuilt, result.Untagged)
+
+	return nil
+}
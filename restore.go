@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/imagesource"
+	"github.com/JohanLindvall/diz/str"
+	"github.com/JohanLindvall/diz/util"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+)
+
+var (
+	hostRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+	// errPreviousToDocker is returned for glob expressions matching hidden tags, which are not valid Docker references
+	errPreviousToDocker = errors.New("hidden tags of previous images cannot be written to the Docker daemon")
+)
+
+// restoreResult holds the tags loaded, retagged and skipped by a restore
+type restoreResult struct {
+	loaded   []string
+	retagged []string
+	skipped  []string
+}
+
+func restore(globTags []string) error {
+	if diz.MatchesPrevious(globTags) {
+		return errPreviousToDocker
+	} else if s, err := getImageSource(); err != nil {
+		return err
+	} else {
+		defer s.Close()
+		if tags, err := s.GlobTags(globTags); err != nil {
+			return err
+		} else if hosts, err := getHosts(); err != nil {
+			return err
+		} else if len(hosts) > 0 && *targetDaemon != "" {
+			return errors.New("-target cannot be combined with -hosts or -hostsfile")
+		} else if len(hosts) > 0 {
+			return restoreHosts(hosts, s, tags)
+		} else if cli, err := getTargetClient(); err != nil {
+			return err
+		} else {
+			fmt.Printf("Restoring %s\n", strings.Join(tags, ", "))
+			result, err := restoreTo(cli, s, tags, *stateFile)
+			result.print()
+			return err
+		}
+	}
+}
+
+// restoreHosts restores the tags to every Docker host concurrently. A failure on one host does not abort the others
+func restoreHosts(hosts []string, s imagesource.ImageSource, tags []string) error {
+	fmt.Printf("Restoring %s to %s\n", strings.Join(tags, ", "), strings.Join(hosts, ", "))
+	results := make([]restoreResult, len(hosts))
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			var hostCli *client.Client
+			if hostCli, errs[i] = getClient(host); errs[i] != nil {
+				return
+			}
+			defer hostCli.Close()
+			state := ""
+			if *stateFile != "" {
+				state = *stateFile + "." + hostRe.ReplaceAllString(host, "_")
+			}
+			results[i], errs[i] = restoreTo(hostCli, s, tags, state)
+		}(i, host)
+	}
+	wg.Wait()
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tLOADED\tRETAGGED\tSKIPPED\tRESULT")
+	for i, host := range hosts {
+		status := "ok"
+		if errs[i] != nil {
+			status = "failed: " + strings.ReplaceAll(errs[i].Error(), "\n", " ")
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", host, len(results[i].loaded), len(results[i].retagged), len(results[i].skipped), status)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("restore failed on %d of %d hosts", failed, len(hosts))
+	}
+	return nil
+}
+
+// getHosts returns the Docker hosts given by the hosts flag and the hosts file. Empty lines and comments are ignored
+func getHosts() (hosts []string, err error) {
+	candidates := strings.Split(*hostList, ",")
+	if *hostsFile != "" {
+		var lines []string
+		if lines, err = util.ReadLines(*hostsFile); err != nil {
+			return
+		}
+		candidates = append(candidates, lines...)
+	}
+	for _, host := range candidates {
+		if i := strings.Index(host, "#"); i != -1 {
+			host = host[:i]
+		}
+		if host = strings.TrimSpace(host); host != "" && !str.StringInSlice(host, hosts) {
+			hosts = append(hosts, host)
+		}
+	}
+	return
+}
+
+// restoreTo restores the tags from the image source to the Docker daemon. Unless forced, images already present are skipped and missing tags are added
+func restoreTo(cli *client.Client, s imagesource.ImageSource, tags []string, stateFile string) (result restoreResult, err error) {
+	load := tags
+	if !*force {
+		if load, err = retagExisting(cli, s, tags, &result); err != nil {
+			return
+		}
+	}
+
+	if len(load) > 0 {
+		err = loadBatches(cli, s, load, stateFile, &result)
+	}
+
+	return
+}
+
+// loadBatches loads the tags into the Docker daemon in batches bounded by the batch size, skipping batches recorded in the state file
+func loadBatches(cli *client.Client, s imagesource.ImageSource, tags []string, stateFile string, result *restoreResult) error {
+	batches, err := getBatches(s, tags)
+	if err != nil {
+		return err
+	}
+	state, err := readState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	// Determine the restored batches before loading, as the workers update the state
+	var pending []int
+	for i, batch := range batches {
+		if stateFile != "" && isRestored(state, batch) {
+			fmt.Printf("Skipping restored batch %d/%d\n", i+1, len(batches))
+			result.skipped = append(result.skipped, diz.GetRepoTags(batch)...)
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	workers := *batchParallel
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var failed error
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				batch := batches[i]
+				batchTags := diz.GetRepoTags(batch)
+				fmt.Printf("Loading batch %d/%d: %s\n", i+1, len(batches), strings.Join(batchTags, ", "))
+				sink := imagesource.NewDockerImageSink(cli)
+				err := imagesource.Copy(s, sink, batchTags)
+				if er := sink.Close(); err == nil {
+					err = er
+				}
+				mutex.Lock()
+				if err == nil {
+					result.loaded = append(result.loaded, batchTags...)
+					state = append(state, diz.GetConfigs(batch)...)
+					err = writeState(stateFile, state)
+				}
+				if err != nil && failed == nil {
+					failed = fmt.Errorf("batch %d/%d failed: %v", i+1, len(batches), err)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, i := range pending {
+		mutex.Lock()
+		stop := failed != nil
+		mutex.Unlock()
+		if stop {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if failed != nil && stateFile != "" {
+		fmt.Printf("Restore can be resumed using the state file '%s'\n", stateFile)
+	}
+
+	return failed
+}
+
+// getBatches splits the images into batches. Batches are only bounded by size for zip sources, which know the image sizes
+func getBatches(s imagesource.ImageSource, tags []string) ([][]diz.Manifest, error) {
+	budget, err := units.FromHumanSize(*batchSize)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := s.GetManifests(tags)
+	if err != nil {
+		return nil, err
+	}
+	size := func(name string) int64 { return 0 }
+	if z, ok := s.(*imagesource.ZipImageSource); ok {
+		size = z.GetUncompressedSize
+	}
+
+	return diz.BatchManifests(manifests, budget, size), nil
+}
+
+func isRestored(state []string, batch []diz.Manifest) bool {
+	for _, config := range diz.GetConfigs(batch) {
+		if !str.StringInSlice(config, state) {
+			return false
+		}
+	}
+	return true
+}
+
+func readState(stateFile string) ([]string, error) {
+	if stateFile == "" {
+		return nil, nil
+	}
+	lines, err := util.ReadLines(stateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return lines, err
+}
+
+func writeState(stateFile string, state []string) error {
+	if stateFile == "" {
+		return nil
+	}
+	return util.WriteLines(stateFile, state)
+}
+
+// retagExisting tags images already present in the Docker daemon and returns the tags which need to be loaded
+func retagExisting(cli *client.Client, s imagesource.ImageSource, tags []string, result *restoreResult) (load []string, err error) {
+	var manifests []diz.Manifest
+	if manifests, err = s.GetManifests(tags); err != nil {
+		return
+	}
+
+	for _, m := range manifests {
+		id := "sha256:" + diz.GetConfig(m)
+		inspect, _, e := cli.ImageInspectWithRaw(context.Background(), id)
+		if client.IsErrNotFound(e) {
+			load = append(load, m.RepoTags...)
+			continue
+		} else if e != nil {
+			err = e
+			return
+		}
+		for _, tag := range m.RepoTags {
+			if hasReference(inspect.RepoTags, tag) {
+				result.skipped = append(result.skipped, tag)
+			} else if err = cli.ImageTag(context.Background(), id, tag); err != nil {
+				return
+			} else {
+				result.retagged = append(result.retagged, tag)
+			}
+		}
+	}
+
+	return
+}
+
+// hasReference returns true if the reference is equal to any of the references
+func hasReference(refs []string, ref string) bool {
+	for _, r := range refs {
+		if dockerref.CompareReferences(r, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r restoreResult) print() {
+	for _, l := range []struct {
+		title string
+		tags  []string
+	}{{"Loaded", r.loaded}, {"Retagged", r.retagged}, {"Skipped", r.skipped}} {
+		if len(l.tags) > 0 {
+			fmt.Printf("%s %d: %s\n", l.title, len(l.tags), strings.Join(l.tags, ", "))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/JohanLindvall/diz/imagesource"
+	"github.com/JohanLindvall/diz/str"
+)
+
+const (
+	partialSuffix    = ".partial"
+	checkpointSuffix = ".checkpoint"
+)
+
+// createResumable writes the images with the given tags one at a time to the partial file, recording the written
+// manifests in the checkpoint file, so that an interrupted create continues with the remaining tags only
+func createResumable(s imagesource.ImageSource, fn string, tags []string, meta *diz.Meta) error {
+	checkpoint := fn + checkpointSuffix
+	zipWriter, out, manifests, err := openPartial(fn)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	manifests = diz.FilterManifests(manifests, tags)
+	remaining := str.RemoveSlice(tags, diz.GetRepoTags(manifests))
+	if len(remaining) < len(tags) {
+		fmt.Printf("Resuming, %d of %d tags already written\n", len(tags)-len(remaining), len(tags))
+	}
+
+	for i, tag := range remaining {
+		fmt.Printf("[%d/%d] %s\n", i+1, len(remaining), tag)
+		var m []diz.Manifest
+		if m, err = s.CopyToZip(zipWriter, []string{tag}); err != nil {
+			return err
+		}
+		manifests = diz.MergeManifests(manifests, m)
+		if err = zipWriter.Flush(); err != nil {
+			return err
+		}
+		if err = writeCheckpoint(checkpoint, manifests); err != nil {
+			return err
+		}
+	}
+
+	err = diz.WriteManifests(manifests, zipWriter)
+	if err == nil {
+		err = diz.WriteMeta(meta, zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteHistory(getHistory(nil, diz.OperationCreate, nil, manifests), zipWriter)
+	}
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	if err == nil {
+		err = os.Remove(checkpoint)
+	}
+	if err == nil {
+		err = updateTags(fn)
+	}
+	return err
+}
+
+// openPartial returns a zip writer continuing the partial file of the output file, and the manifests of the checkpoint
+// whose files were all salvaged. A new partial file is created if there is none
+func openPartial(fn string) (zipWriter *hashzip.Writer, out *outFile, manifests []diz.Manifest, err error) {
+	partial := fn + partialSuffix
+	checkpoint := fn + checkpointSuffix
+	var f *os.File
+	if f, err = os.OpenFile(partial, os.O_RDWR, 0); os.IsNotExist(err) {
+		if f, err = os.Create(partial); err != nil {
+			return
+		}
+		if err = os.Remove(checkpoint); err != nil && !os.IsNotExist(err) {
+			f.Close()
+			return
+		}
+		return hashzip.NewWriterLevel(f, *level), &outFile{File: f, name: fn, sorted: *reproducible}, nil, nil
+	} else if err != nil {
+		return
+	}
+
+	if zipWriter, err = hashzip.NewResumeWriterLevel(f, *level, diz.ManifestFiles()); err != nil {
+		f.Close()
+		return
+	}
+	out = &outFile{File: f, name: fn, sorted: *reproducible}
+
+	var checkpointed []diz.Manifest
+	if checkpointed, err = readCheckpoint(checkpoint); err != nil {
+		out.Close()
+		return
+	}
+	for _, m := range checkpointed {
+		complete := zipWriter.Exists(diz.EntryName(m.Config))
+		for _, l := range m.Layers {
+			complete = complete && zipWriter.Exists(diz.EntryName(l))
+		}
+		if complete {
+			manifests = append(manifests, m)
+		}
+	}
+
+	return
+}
+
+func readCheckpoint(checkpoint string) (manifests []diz.Manifest, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(checkpoint); os.IsNotExist(err) {
+		return nil, nil
+	} else if err == nil {
+		err = json.Unmarshal(b, &manifests)
+	}
+	return
+}
+
+// writeCheckpoint atomically replaces the checkpoint file with the manifests
+func writeCheckpoint(checkpoint string, manifests []diz.Manifest) error {
+	if b, err := json.Marshal(manifests); err != nil {
+		return err
+	} else if err = ioutil.WriteFile(checkpoint+".tmp", b, 0644); err != nil {
+		return err
+	} else {
+		return os.Rename(checkpoint+".tmp", checkpoint)
+	}
+}
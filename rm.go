@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/imagesource"
+	"github.com/JohanLindvall/diz/str"
+	"github.com/docker/go-units"
+)
+
+// rm writes a copy of the initial archive without the tags matching the globs. Images left without tags are dropped
+func rm(initial, fn string, globTags []string) error {
+	z, err := imagesource.NewZipImageSource(initial)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	history, err := z.GetHistory()
+	if err != nil {
+		return err
+	}
+	manifests := diz.RemoveTags(z.Manifests(), globTags)
+	removed := str.RemoveSlice(diz.GetRepoTags(z.Manifests()), diz.GetRepoTags(manifests))
+
+	zipWriter, out, err := getZipWriter(fn, false)
+	if err != nil {
+		return err
+	}
+	defer out.Discard()
+	if err = z.CopyManifestsToZip(zipWriter, manifests); err == nil {
+		err = diz.WriteManifests(manifests, zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteMeta(getMeta(initial, z.Meta()), zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteHistory(getHistory(history, diz.OperationRemove, z.Manifests(), manifests), zipWriter)
+	}
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d tags: %s\n", len(removed), strings.Join(removed, ", "))
+	fmt.Printf("Reclaimed %s\n", units.HumanSize(float64(z.UnreferencedSize(manifests))))
+
+	return nil
+}
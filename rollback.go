@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/dockerref"
+	"github.com/JohanLindvall/diz/imagesource"
+)
+
+// rollback writes a copy of the initial archive with the tag referring to its previous image, optionally the nth one
+func rollback(initial, fn, tag string, args []string) error {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("bad previous image number %s", args[0])
+		}
+	}
+
+	z, err := imagesource.NewZipImageSource(initial)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	history, err := z.GetHistory()
+	if err != nil {
+		return err
+	}
+	manifests, err := diz.Rollback(z.Manifests(), tag, n)
+	if err != nil {
+		return err
+	}
+
+	zipWriter, out, err := getZipWriter(fn, false)
+	if err != nil {
+		return err
+	}
+	defer out.Discard()
+	if err = z.CopyManifestsToZip(zipWriter, manifests); err == nil {
+		err = diz.WriteManifests(manifests, zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteMeta(getMeta(initial, z.Meta()), zipWriter)
+	}
+	if err == nil {
+		err = diz.WriteHistory(getHistory(history, diz.OperationRollback, z.Manifests(), manifests), zipWriter)
+	}
+	if er := zipWriter.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		for _, t := range m.RepoTags {
+			if !diz.IsPreviousTag(t) && dockerref.CompareReferences(t, tag) {
+				fmt.Printf("Rolled back %s to %s\n", tag, shortID(m.Config))
+			}
+		}
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 
 	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/dockerref"
 	"github.com/JohanLindvall/diz/imagesource"
 	"github.com/JohanLindvall/diz/util"
 )
@@ -17,17 +18,43 @@ func serve(zip string) error {
 		return err
 	}
 
-	digestedTags, err := is.GetDigestToTags()
+	s, err := newServer(is)
 	if err != nil {
 		return err
 	}
 
-	return http.ListenAndServe(":5000", &server{is: is, digestedTags: digestedTags})
+	return http.ListenAndServe(":5000", s)
 }
 
 type server struct {
 	is           *imagesource.ZipImageSource
 	digestedTags map[string][]string
+	// aliases holds the hidden tags of previous images by their normalized pullable alias, e.g. "app:prev1-1.0"
+	aliases map[string]string
+}
+
+// newServer returns a registry server for the images of the zip source. Previous images are served by their digest
+// or by the alias of their hidden tag, unless a tag of the archive has the same name
+func newServer(is *imagesource.ZipImageSource) (*server, error) {
+	digestedTags, err := is.GetDigestToTags()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]bool, 0)
+	for _, t := range diz.GetRepoTags(is.Manifests()) {
+		tags[dockerref.NormalizeReference(t)] = true
+	}
+	aliases := make(map[string]string, 0)
+	for _, t := range diz.GetRepoTags(is.Manifests()) {
+		if diz.IsPreviousTag(t) {
+			if alias := dockerref.NormalizeReference(diz.PreviousAlias(t)); !tags[alias] {
+				aliases[alias] = t
+			}
+		}
+	}
+
+	return &server{is: is, digestedTags: digestedTags, aliases: aliases}, nil
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -54,6 +81,9 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	} else if match := manifestRe.FindStringSubmatch(r.URL.Path); match != nil {
 		repoTag := match[1] + ":" + match[2]
+		if t, ok := s.aliases[dockerref.NormalizeReference(repoTag)]; ok {
+			repoTag = t
+		}
 		if err := s.returnRegistryManifest(w, repoTag); err == nil {
 			return
 		}
@@ -78,7 +108,7 @@ func (s *server) returnRegistryManifest(w http.ResponseWriter, repoTag string) (
 
 func sendDigestResponse(w http.ResponseWriter, m diz.RegistryManifest) error {
 	if js, digest, err := diz.GetManifestBytes(m); err == nil {
-		w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", digest))
+		w.Header().Set("Docker-Content-Digest", "sha256:"+digest)
 		w.Header().Set("Content-Type", m.MediaType)
 		_, err := w.Write(js)
 		return err
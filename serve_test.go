@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/JohanLindvall/diz/diz"
+	"github.com/JohanLindvall/diz/hashzip"
+	"github.com/JohanLindvall/diz/imagesource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServePrevious(t *testing.T) {
+	f, err := ioutil.TempFile("", "diz-serve")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	zipWriter := hashzip.NewWriter(f)
+	for _, name := range []string{"a.json", "b.json", "x/layer.tar", "y/layer.tar"} {
+		assert.Nil(t, diz.WriteEntry(zipWriter, name, bytes.NewReader([]byte(name))))
+	}
+	assert.Nil(t, diz.WriteManifests([]diz.Manifest{
+		{Config: "a.json", RepoTags: []string{"app:1.0"}, Layers: []string{"x/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"app:1.0@prev1"}, Layers: []string{"y/layer.tar"}},
+	}, zipWriter))
+	assert.Nil(t, zipWriter.Close())
+	assert.Nil(t, f.Close())
+
+	is, err := imagesource.NewZipImageSource(f.Name())
+	assert.Nil(t, err)
+	defer is.Close()
+	s, err := newServer(is)
+	assert.Nil(t, err)
+
+	get := func(path string) (*httptest.ResponseRecorder, diz.RegistryManifest) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var m diz.RegistryManifest
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &m))
+		}
+		return w, m
+	}
+
+	// The previous image is pulled by the alias of its hidden tag, then by its digest
+	w, m := get("/v2/app/manifests/prev1-1.0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sha256:b", m.Config.Digest)
+	digest := w.Header().Get("Docker-Content-Digest")
+	w, m = get("/v2/app/manifests/" + digest)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sha256:b", m.Config.Digest)
+	assert.Equal(t, digest, w.Header().Get("Docker-Content-Digest"))
+
+	_, m = get("/v2/app/manifests/1.0")
+	assert.Equal(t, "sha256:a", m.Config.Digest)
+}